@@ -0,0 +1,200 @@
+// Package catalog is the curated manifest of blacklist sources, grouped by category
+package catalog
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+)
+
+// Source is a curated blacklist source
+type Source struct {
+	Name        string `json:"name"`
+	Category    string `json:"category"`
+	Description string `json:"description"`
+	Node        string `json:"node"`
+	Prefix      string `json:"prefix"`
+	URL         string `json:"url"`
+}
+
+// Catalog is a versioned manifest of curated blacklist sources
+type Catalog struct {
+	Version int       `json:"version"`
+	Sources []*Source `json:"sources"`
+}
+
+// Default returns the catalog built into the binary
+func Default() *Catalog {
+	c, err := parse([]byte(manifest))
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// Load returns the catalog in file if it's at least as recent as the built in one, so a
+// catalog updated on the router survives, but an outdated one doesn't outlive an upgrade.
+// The built in catalog is returned if file doesn't exist.
+func Load(file string) (*Catalog, error) {
+	d := Default()
+	if file == "" {
+		return d, nil
+	}
+
+	b, err := ioutil.ReadFile(file)
+	switch {
+	case os.IsNotExist(err):
+		return d, nil
+	case err != nil:
+		return d, err
+	}
+
+	c, err := parse(b)
+	if err != nil {
+		return d, fmt.Errorf("catalog %s: %v", file, err)
+	}
+	if c.Version < d.Version {
+		return d, nil
+	}
+	return c, nil
+}
+
+// parse decodes and checks a catalog manifest
+func parse(b []byte) (*Catalog, error) {
+	c := &Catalog{}
+	if err := json.Unmarshal(b, c); err != nil {
+		return nil, err
+	}
+
+	names := make(map[string]bool)
+	for _, s := range c.Sources {
+		switch {
+		case s.Name == "" || s.Category == "" || s.URL == "":
+			return nil, fmt.Errorf("source %q needs a name, category and url", s.Name)
+		case s.Node != "domains" && s.Node != "hosts":
+			return nil, fmt.Errorf("source %s: node %q must be domains or hosts", s.Name, s.Node)
+		case names[s.Name]:
+			return nil, fmt.Errorf("source %s is listed more than once", s.Name)
+		}
+		names[s.Name] = true
+	}
+	return c, nil
+}
+
+// Categories returns the catalog's categories in alphabetical order
+func (c *Catalog) Categories() []string {
+	var (
+		cats []string
+		seen = make(map[string]bool)
+	)
+	for _, s := range c.Sources {
+		if !seen[s.Category] {
+			seen[s.Category] = true
+			cats = append(cats, s.Category)
+		}
+	}
+	sort.Strings(cats)
+	return cats
+}
+
+// Has returns true if category is in the catalog
+func (c *Catalog) Has(category string) bool {
+	for _, s := range c.Sources {
+		if s.Category == category {
+			return true
+		}
+	}
+	return false
+}
+
+// Category returns the sources in a category
+func (c *Catalog) Category(category string) (srcs []*Source) {
+	for _, s := range c.Sources {
+		if s.Category == category {
+			srcs = append(srcs, s)
+		}
+	}
+	return srcs
+}
+
+// manifest is the built in catalog; increment its version whenever it changes
+const manifest = `{
+  "version": 1,
+  "sources": [
+    {
+      "name": "adaway",
+      "category": "ads",
+      "description": "Blocking mobile ad providers and some analytics providers",
+      "node": "hosts",
+      "prefix": "127.0.0.1 ",
+      "url": "https://adaway.org/hosts.txt"
+    },
+    {
+      "name": "yoyo",
+      "category": "ads",
+      "description": "Fully Qualified Domain Names only - no prefix to strip",
+      "node": "hosts",
+      "prefix": "",
+      "url": "https://pgl.yoyo.org/as/serverlist.php?hostformat=nohtml&showintro=0&mimetype=plaintext"
+    },
+    {
+      "name": "sinfonietta_porn",
+      "category": "adult",
+      "description": "Pornography sites",
+      "node": "hosts",
+      "prefix": "0.0.0.0 ",
+      "url": "https://raw.githubusercontent.com/Sinfonietta/hostfiles/master/pornography-hosts"
+    },
+    {
+      "name": "nocoin",
+      "category": "crypto-mining",
+      "description": "Browser crypto-mining scripts",
+      "node": "hosts",
+      "prefix": "0.0.0.0 ",
+      "url": "https://raw.githubusercontent.com/hoshsadiq/adblock-nocoin-list/master/hosts.txt"
+    },
+    {
+      "name": "sinfonietta_gambling",
+      "category": "gambling",
+      "description": "Gambling sites",
+      "node": "hosts",
+      "prefix": "0.0.0.0 ",
+      "url": "https://raw.githubusercontent.com/Sinfonietta/hostfiles/master/gambling-hosts"
+    },
+    {
+      "name": "urlhaus",
+      "category": "malware",
+      "description": "Malware distribution sites tracked by abuse.ch URLhaus",
+      "node": "hosts",
+      "prefix": "127.0.0.1\t",
+      "url": "https://urlhaus.abuse.ch/downloads/hostfile/"
+    },
+    {
+      "name": "phishing_army",
+      "category": "phishing",
+      "description": "Phishing domains collected by Phishing Army",
+      "node": "domains",
+      "prefix": "",
+      "url": "https://phishing.army/download/phishing_army_blocklist.txt"
+    },
+    {
+      "name": "sinfonietta_social",
+      "category": "social",
+      "description": "Social media sites",
+      "node": "hosts",
+      "prefix": "0.0.0.0 ",
+      "url": "https://raw.githubusercontent.com/Sinfonietta/hostfiles/master/social-hosts"
+    },
+    {
+      "name": "simple_tracking",
+      "category": "tracking",
+      "description": "Basic tracking list by Disconnect",
+      "node": "domains",
+      "prefix": "",
+      "url": "https://s3.amazonaws.com/lists.disconnect.me/simple_tracking.txt"
+    }
+  ]
+}
+`
@@ -0,0 +1,84 @@
+package catalog
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDefault(t *testing.T) {
+	Convey("Testing Default()", t, func() {
+		c := Default()
+		So(c.Version, ShouldBeGreaterThan, 0)
+		So(c.Categories(), ShouldResemble, []string{"ads", "adult", "crypto-mining", "gambling", "malware", "phishing", "social", "tracking"})
+
+		So(c.Has("malware"), ShouldBeTrue)
+		So(c.Has("knitting"), ShouldBeFalse)
+		So(c.Category("knitting"), ShouldBeEmpty)
+
+		for _, s := range c.Category("ads") {
+			So(s.Category, ShouldEqual, "ads")
+		}
+		So(len(c.Category("ads")), ShouldEqual, 2)
+	})
+}
+
+func TestLoad(t *testing.T) {
+	Convey("Testing Load()", t, func() {
+		f, err := ioutil.TempFile("/tmp", "blacklist.catalog")
+		So(err, ShouldBeNil)
+		defer os.Remove(f.Name())
+		f.Close()
+
+		write := func(s string) {
+			So(ioutil.WriteFile(f.Name(), []byte(s), 0644), ShouldBeNil)
+		}
+
+		Convey("No file uses the built in catalog", func() {
+			c, err := Load("")
+			So(err, ShouldBeNil)
+			So(c, ShouldResemble, Default())
+
+			c, err = Load("/tmp/no/such/catalog.json")
+			So(err, ShouldBeNil)
+			So(c, ShouldResemble, Default())
+		})
+
+		Convey("A newer catalog updates the built in one", func() {
+			write(`{"version": 99, "sources": [{"name": "bees", "category": "apiary", "node": "domains", "url": "https://bees.example.org/list"}]}`)
+			c, err := Load(f.Name())
+			So(err, ShouldBeNil)
+			So(c.Version, ShouldEqual, 99)
+			So(c.Categories(), ShouldResemble, []string{"apiary"})
+		})
+
+		Convey("An older catalog doesn't replace the built in one", func() {
+			write(`{"version": 0, "sources": []}`)
+			c, err := Load(f.Name())
+			So(err, ShouldBeNil)
+			So(c, ShouldResemble, Default())
+		})
+
+		Convey("A malformed catalog is reported and the built in one is used", func() {
+			tests := []struct {
+				cfg string
+				exp string
+			}{
+				{cfg: `{"version": `, exp: "unexpected end of JSON input"},
+				{cfg: `{"version": 99, "sources": [{"name": "bees", "category": "apiary", "node": "domains"}]}`, exp: `source "bees" needs a name, category and url`},
+				{cfg: `{"version": 99, "sources": [{"name": "bees", "category": "apiary", "node": "roots", "url": "https://bees.example.org/list"}]}`, exp: `source bees: node "roots" must be domains or hosts`},
+				{cfg: `{"version": 99, "sources": [{"name": "bees", "category": "apiary", "node": "domains", "url": "https://bees.example.org/list"}, {"name": "bees", "category": "wasps", "node": "hosts", "url": "https://wasps.example.org/list"}]}`, exp: "source bees is listed more than once"},
+			}
+
+			for _, tt := range tests {
+				write(tt.cfg)
+				c, err := Load(f.Name())
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "catalog "+f.Name()+": "+tt.exp)
+				So(c, ShouldResemble, Default())
+			}
+		})
+	})
+}
@@ -0,0 +1,291 @@
+package dnsmasq
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Load parses dnsmasq configuration files, e.g. /etc/dnsmasq.conf, and everything they include
+func Load(files ...string) (Conf, error) {
+	var (
+		c    = make(Conf)
+		seen = make(map[string]bool)
+	)
+	for _, f := range files {
+		if err := c.confFile(f, seen); err != nil {
+			return c, err
+		}
+	}
+	return c, nil
+}
+
+// LoadHosts reads hosts format files, such as those an addn-hosts directive names
+func LoadHosts(files ...string) (Conf, error) {
+	c := make(Conf)
+	for _, f := range files {
+		if err := c.hosts(f); err != nil {
+			return c, err
+		}
+	}
+	return c, nil
+}
+
+// Blocklist returns the entries that block a domain: address= and addn-hosts entries, and
+// server= or local= entries without an upstream, which dnsmasq answers NXDOMAIN
+func (c Conf) Blocklist() Conf {
+	b := make(Conf)
+	for k, h := range c {
+		if !h.Server || h.IP == "" {
+			b[k] = h
+		}
+	}
+	return b
+}
+
+// Match returns the entry dnsmasq applies to name: the entry for name or its closest parent
+// domain, or the catch all address=/#/ entry
+func (c Conf) Match(name string) (Host, bool) {
+	for d := strings.ToLower(strings.TrimSuffix(name, ".")); ; {
+		if h, ok := c[d]; ok {
+			return h, true
+		}
+		i := strings.IndexByte(d, '.')
+		if i < 0 {
+			break
+		}
+		d = d[i+1:]
+	}
+	h, ok := c["#"]
+	return h, ok
+}
+
+// Keys returns the configuration's domains in alphabetical order
+func (c Conf) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// parse reads dnsmasq configuration from r, which was read from file if it isn't ""
+func (c Conf) parse(r io.Reader, file string, seen map[string]bool) error {
+	b := bufio.NewScanner(r)
+	for n := 1; b.Scan(); n++ {
+		var (
+			err  error
+			k, v = directive(b.Text())
+		)
+
+		switch k {
+		case "address":
+			err = c.domains(v, file, false)
+		case "local", "server":
+			err = c.domains(v, file, true)
+		case "addn-hosts":
+			err = c.hostsFiles(v, seen)
+		case "conf-dir":
+			err = c.confDir(v, seen)
+		case "conf-file":
+			err = c.confFile(v, seen)
+		}
+
+		switch err.(type) {
+		case nil:
+		case *parseError:
+			// from an included file
+			return err
+		default:
+			return &parseError{err: err, file: file, line: n}
+		}
+	}
+	return b.Err()
+}
+
+// parseError locates a configuration error
+type parseError struct {
+	err  error
+	file string
+	line int
+}
+
+func (e *parseError) Error() string {
+	if e.file == "" {
+		return fmt.Sprintf("line %d: %v", e.line, e.err)
+	}
+	return fmt.Sprintf("%s: line %d: %v", e.file, e.line, e.err)
+}
+
+// directive splits a configuration line into its option and value, dropping comments
+func directive(l string) (string, string) {
+	for i := range l {
+		if l[i] == '#' && (i == 0 || l[i-1] == ' ' || l[i-1] == '\t') {
+			l = l[:i]
+			break
+		}
+	}
+
+	l = strings.TrimSpace(l)
+	if i := strings.Index(l, "="); i > -1 {
+		return strings.TrimSpace(l[:i]), strings.TrimSpace(l[i+1:])
+	}
+	return l, ""
+}
+
+// domains adds the domains of an address=, server= or local= value: /domain[/domain...]/[ip]
+func (c Conf) domains(v, file string, server bool) error {
+	if !strings.HasPrefix(v, "/") {
+		if server {
+			// an upstream resolver for every domain
+			return nil
+		}
+		return fmt.Errorf("malformed address=%s", v)
+	}
+
+	d := strings.Split(v[1:], "/")
+	if len(d) < 2 {
+		return fmt.Errorf("malformed domain list %s", v)
+	}
+
+	ip := d[len(d)-1]
+	for _, k := range d[:len(d)-1] {
+		if k != "" {
+			c[strings.ToLower(k)] = Host{IP: ip, Server: server, File: file}
+		}
+	}
+	return nil
+}
+
+// hostsFiles adds the entries of an addn-hosts file, or of every file in an addn-hosts directory
+func (c Conf) hostsFiles(path string, seen map[string]bool) error {
+	files, err := dir(path, nil)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range files {
+		if seen[f] {
+			continue
+		}
+		seen[f] = true
+
+		if err = c.hosts(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hosts adds the entries of a hosts format file: <ip> <name> [<name>...]
+func (c Conf) hosts(file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	b := bufio.NewScanner(f)
+	for b.Scan() {
+		l := b.Text()
+		if i := strings.Index(l, "#"); i > -1 {
+			l = l[:i]
+		}
+		x := strings.Fields(l)
+		if len(x) < 2 {
+			continue
+		}
+		for _, k := range x[1:] {
+			c[strings.ToLower(k)] = Host{IP: x[0], File: file}
+		}
+	}
+	return b.Err()
+}
+
+// confDir parses the files in a conf-dir=<directory>[,<extension>...] directory; *.ext only
+// includes files with that extension, any other extension excludes them
+func (c Conf) confDir(v string, seen map[string]bool) error {
+	x := strings.Split(v, ",")
+	files, err := dir(x[0], x[1:])
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		if err = c.confFile(f, seen); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// confFile parses a configuration file, unless it's already been parsed
+func (c Conf) confFile(file string, seen map[string]bool) error {
+	if seen[file] {
+		return nil
+	}
+	seen[file] = true
+
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return c.parse(f, file, seen)
+}
+
+// dir returns path if it's a file, otherwise the files in the directory that dnsmasq reads,
+// i.e. not hidden, backup or emacs autosave files, filtered by extension
+func dir(path string, exts []string) ([]string, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() {
+		return []string{path}, nil
+	}
+
+	list, err := ioutil.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, f := range list {
+		n := f.Name()
+		switch {
+		case f.IsDir(),
+			strings.HasPrefix(n, "."),
+			strings.HasSuffix(n, "~"),
+			strings.HasPrefix(n, "#") && strings.HasSuffix(n, "#"),
+			!extOK(n, exts):
+			continue
+		}
+		files = append(files, filepath.Join(path, n))
+	}
+	return files, nil
+}
+
+// extOK returns true if a file name passes conf-dir's extension filters
+func extOK(name string, exts []string) bool {
+	include := false
+	for _, e := range exts {
+		e = strings.TrimSpace(e)
+		if strings.HasPrefix(e, "*") {
+			include = true
+			if strings.HasSuffix(name, e[1:]) {
+				return true
+			}
+			continue
+		}
+		if e != "" && strings.HasSuffix(name, e) {
+			return false
+		}
+	}
+	return !include
+}
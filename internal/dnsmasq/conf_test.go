@@ -0,0 +1,191 @@
+package dnsmasq
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestParseDirectives(t *testing.T) {
+	Convey("Testing Parse() with dnsmasq directives", t, func() {
+		tests := []struct {
+			name string
+			conf string
+			exp  Conf
+			err  string
+		}{
+			{
+				name: "comments and blank lines",
+				conf: "# blocked\n\n   \naddress=/a.com/0.0.0.0 # trailing comment\n",
+				exp:  Conf{"a.com": {IP: "0.0.0.0"}},
+			},
+			{
+				name: "a multi-domain address",
+				conf: "address=/a.com/B.com/c.com/0.0.0.0\n",
+				exp:  Conf{"a.com": {IP: "0.0.0.0"}, "b.com": {IP: "0.0.0.0"}, "c.com": {IP: "0.0.0.0"}},
+			},
+			{
+				name: "an NXDOMAIN address and local",
+				conf: "address=/a.com/\nlocal=/b.com/c.com/\n",
+				exp:  Conf{"a.com": {}, "b.com": {Server: true}, "c.com": {Server: true}},
+			},
+			{
+				name: "servers and upstream resolvers",
+				conf: "server=8.8.8.8\nserver=/a.com/#\nserver=/b.com/192.168.1.1#5353\nno-resolv\n",
+				exp:  Conf{"a.com": {IP: "#", Server: true}, "b.com": {IP: "192.168.1.1#5353", Server: true}},
+			},
+			{
+				name: "the catch all domain",
+				conf: "address=/#/0.0.0.0\n",
+				exp:  Conf{"#": {IP: "0.0.0.0"}},
+			},
+			{
+				name: "a malformed address",
+				conf: "address=/a.com/0.0.0.0\naddress=a.com\n",
+				err:  "line 2: malformed address=a.com",
+			},
+			{
+				name: "a malformed domain list",
+				conf: "server=/a.com\n",
+				err:  "line 1: malformed domain list /a.com",
+			},
+		}
+
+		for _, tt := range tests {
+			Convey("with "+tt.name, func() {
+				c := make(Conf)
+				err := c.Parse(&Mapping{Contents: []byte(tt.conf)})
+				if tt.err != "" {
+					So(err.Error(), ShouldEqual, tt.err)
+					return
+				}
+				So(err, ShouldBeNil)
+				So(c, ShouldResemble, tt.exp)
+			})
+		}
+	})
+}
+
+func TestLoad(t *testing.T) {
+	Convey("Testing Load() following includes", t, func() {
+		dir, err := ioutil.TempDir("/tmp", "testDnsmasq")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		var (
+			d     = filepath.Join(dir, "dnsmasq.d")
+			main  = filepath.Join(dir, "dnsmasq.conf")
+			hosts = filepath.Join(dir, "hosts.block")
+			extra = filepath.Join(dir, "extra.conf")
+		)
+		So(os.Mkdir(d, 0755), ShouldBeNil)
+
+		files := map[string]string{
+			main:                            "conf-dir=" + d + ",*.conf\nconf-file=" + extra + "\naddn-hosts=" + hosts + "\nserver=1.1.1.1\n",
+			extra:                           "local=/nx.com/\nconf-file=" + main + "\n",
+			hosts:                           "127.0.0.1 localhost\n0.0.0.0 Ads.com tracker.com # blocked\n",
+			d + "/domains.a.blacklist.conf": "address=/a.com/0.0.0.0\n",
+			d + "/roots.x.blacklist.conf":   "server=/good.com/#\n",
+			d + "/other.conf.bak":           "address=/bak.com/0.0.0.0\n",
+			d + "/.hidden.conf":             "address=/hidden.com/0.0.0.0\n",
+			d + "/pihole.conf":              "address=/pi.com/b.pi.com/::\n",
+		}
+		for f, s := range files {
+			So(ioutil.WriteFile(f, []byte(s), 0644), ShouldBeNil)
+		}
+
+		c, err := Load(main)
+		So(err, ShouldBeNil)
+		So(c, ShouldResemble, Conf{
+			"a.com":       {IP: "0.0.0.0", File: d + "/domains.a.blacklist.conf"},
+			"ads.com":     {IP: "0.0.0.0", File: hosts},
+			"b.pi.com":    {IP: "::", File: d + "/pihole.conf"},
+			"good.com":    {IP: "#", Server: true, File: d + "/roots.x.blacklist.conf"},
+			"localhost":   {IP: "127.0.0.1", File: hosts},
+			"nx.com":      {Server: true, File: extra},
+			"pi.com":      {IP: "::", File: d + "/pihole.conf"},
+			"tracker.com": {IP: "0.0.0.0", File: hosts},
+		})
+
+		Convey("The blocklist excludes forwarded domains", func() {
+			b := c.Blocklist()
+			So(b.Keys(), ShouldResemble, []string{"a.com", "ads.com", "b.pi.com", "localhost", "nx.com", "pi.com", "tracker.com"})
+		})
+
+		Convey("A conf-dir extension excludes files", func() {
+			So(ioutil.WriteFile(main, []byte("conf-dir="+d+",.bak,.conf\n"), 0644), ShouldBeNil)
+			c, err := Load(main)
+			So(err, ShouldBeNil)
+			So(c.Keys(), ShouldResemble, []string{})
+		})
+
+		Convey("Errors are reported with their file and line", func() {
+			So(ioutil.WriteFile(extra, []byte("\naddress=oops\n"), 0644), ShouldBeNil)
+			_, err := Load(main)
+			So(err.Error(), ShouldEqual, extra+": line 2: malformed address=oops")
+
+			_, err = Load(filepath.Join(dir, "missing.conf"))
+			So(os.IsNotExist(err), ShouldBeTrue)
+		})
+	})
+}
+
+func TestMatch(t *testing.T) {
+	Convey("Testing Conf.Match()", t, func() {
+		c := Conf{
+			"ads.com":     {IP: "0.0.0.0"},
+			"ok.ads.com":  {IP: "#", Server: true},
+			"school.edu":  {IP: "1.1.1.1", Server: true},
+			"tracker.net": {},
+		}
+
+		tests := []struct {
+			name string
+			exp  Host
+			ok   bool
+		}{
+			{name: "ads.com", exp: Host{IP: "0.0.0.0"}, ok: true},
+			{name: "www.ads.com.", exp: Host{IP: "0.0.0.0"}, ok: true},
+			{name: "cdn.OK.ads.com", exp: Host{IP: "#", Server: true}, ok: true},
+			{name: "a.b.tracker.net", exp: Host{}, ok: true},
+			{name: "example.org", ok: false},
+			{name: "com", ok: false},
+		}
+		for _, tt := range tests {
+			h, ok := c.Match(tt.name)
+			So(ok, ShouldEqual, tt.ok)
+			So(h, ShouldResemble, tt.exp)
+		}
+
+		c["#"] = Host{IP: "192.168.1.1"}
+		h, ok := c.Match("example.org")
+		So(ok, ShouldBeTrue)
+		So(h, ShouldResemble, Host{IP: "192.168.1.1"})
+		h, _ = c.Match("school.edu")
+		So(h, ShouldResemble, Host{IP: "1.1.1.1", Server: true})
+	})
+}
+
+func TestLoadHosts(t *testing.T) {
+	Convey("Testing LoadHosts()", t, func() {
+		dir, err := ioutil.TempDir("/tmp", "testDnsmasq")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		f := filepath.Join(dir, "hosts.yoyo.hosts")
+		So(ioutil.WriteFile(f, []byte("# blocked\n0.0.0.0 ads.com\n0.0.0.0 Tracker.net # comment\n"), 0644), ShouldBeNil)
+
+		c, err := LoadHosts(f)
+		So(err, ShouldBeNil)
+		So(c, ShouldResemble, Conf{
+			"ads.com":     {IP: "0.0.0.0", File: f},
+			"tracker.net": {IP: "0.0.0.0", File: f},
+		})
+
+		_, err = LoadHosts(filepath.Join(dir, "missing"))
+		So(err, ShouldNotBeNil)
+	})
+}
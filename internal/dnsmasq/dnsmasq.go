@@ -1,26 +1,21 @@
-//Package dnsmasq parses dnsmasq.conf address and server name IP mapping files
+// Package dnsmasq parses dnsmasq.conf address and server name IP mapping files, and the
+// conf-dir, conf-file and addn-hosts files they include
 package dnsmasq
 
 import (
-	"bufio"
 	"bytes"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"io"
 	"net"
 	"os"
 )
 
-const (
-	address = "address="
-	server  = "server="
-)
-
 // Host is a container for IP addresses
 type Host struct {
 	IP     string `json:"IP,omitempty"`
 	Server bool   `json:"Server,omitempty"`
+	File   string `json:"File,omitempty"`
 }
 
 // Conf is map of Hosts
@@ -70,21 +65,11 @@ func matchIP(ip string, ips []string) bool {
 	return true
 }
 
-// Parse extracts host to IP mappings from a dnsmasq configuration file
+// Parse extracts host to IP mappings from a dnsmasq configuration file; address=, server= and
+// local= directives can list several domains, and conf-dir=, conf-file= and addn-hosts= includes
+// are followed. Comments and other directives are skipped.
 func (c Conf) Parse(r confLoader) error {
-	b := bufio.NewScanner(r.read())
-	for b.Scan() {
-		d := bytes.Split(bytes.TrimSpace(b.Bytes()), []byte("/"))
-		switch {
-		case len(d) < 3:
-			return errors.New("no dnsmasq configuration mapping entries found")
-		case bytes.HasPrefix(d[0], []byte(address)):
-			c[string(d[1])] = Host{IP: string(d[2]), Server: false}
-		case bytes.HasPrefix(d[0], []byte(server)):
-			c[string(d[1])] = Host{IP: string(d[2]), Server: true}
-		}
-	}
-	return nil
+	return c.parse(r.read(), "", make(map[string]bool))
 }
 
 func (m *Mapping) read() io.Reader {
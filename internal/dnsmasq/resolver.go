@@ -0,0 +1,178 @@
+package dnsmasq
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// Resolver queries a particular DNS server, unlike the system resolver
+type Resolver struct {
+	Addr    string        // server address, the port defaults to 53
+	Net     string        // udp or tcp, defaults to udp
+	Timeout time.Duration // defaults to 2 seconds
+}
+
+// Answer is a DNS server's response to an A or AAAA query
+type Answer struct {
+	NXDomain bool
+	IPs      []string
+}
+
+// Lookup queries the resolver for name's A records; a truncated UDP response is retried over TCP
+func (r *Resolver) Lookup(name string) (*Answer, error) {
+	return r.lookup(name, dnsmessage.TypeA)
+}
+
+// Lookup6 queries the resolver for name's AAAA records, for names redirected to an IPv6 address
+func (r *Resolver) Lookup6(name string) (*Answer, error) {
+	return r.lookup(name, dnsmessage.TypeAAAA)
+}
+
+func (r *Resolver) lookup(name string, t dnsmessage.Type) (*Answer, error) {
+	n, err := dnsmessage.NewName(strings.TrimSuffix(name, ".") + ".")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+
+	id := uint16(rand.Intn(1 << 16))
+	q, err := (&dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: id, RecursionDesired: true},
+		Questions: []dnsmessage.Question{{Name: n, Type: t, Class: dnsmessage.ClassINET}},
+	}).Pack()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+
+	b, err := r.Exchange(q)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+
+	var m dnsmessage.Message
+	switch err = m.Unpack(b); {
+	case err != nil:
+		return nil, fmt.Errorf("%s: %v", name, err)
+	case m.ID != id:
+		return nil, fmt.Errorf("%s: response ID %d doesn't match query ID %d", name, m.ID, id)
+	case m.Truncated && r.network() == "udp":
+		return (&Resolver{Addr: r.Addr, Net: "tcp", Timeout: r.Timeout}).lookup(name, t)
+	}
+
+	a := &Answer{}
+	switch m.RCode {
+	case dnsmessage.RCodeSuccess:
+	case dnsmessage.RCodeNameError:
+		a.NXDomain = true
+	default:
+		return nil, fmt.Errorf("%s: %s", name, m.RCode)
+	}
+
+	for _, x := range m.Answers {
+		switch ip := x.Body.(type) {
+		case *dnsmessage.AResource:
+			a.IPs = append(a.IPs, net.IP(ip.A[:]).String())
+		case *dnsmessage.AAAAResource:
+			a.IPs = append(a.IPs, net.IP(ip.AAAA[:]).String())
+		}
+	}
+	sort.Strings(a.IPs)
+	return a, nil
+}
+
+// Exchange sends a packed query to the resolver and returns its packed response
+func (r *Resolver) Exchange(q []byte) ([]byte, error) {
+	timeout := r.Timeout
+	if timeout == 0 {
+		timeout = 2 * time.Second
+	}
+
+	conn, err := net.DialTimeout(r.network(), r.addr(), timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if err = conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, err
+	}
+
+	if r.network() == "udp" {
+		if _, err = conn.Write(q); err != nil {
+			return nil, err
+		}
+		b := make([]byte, 4096)
+		n, err := conn.Read(b)
+		return b[:n], err
+	}
+
+	// DNS over TCP prefixes each message with its length
+	if _, err = conn.Write(append([]byte{byte(len(q) >> 8), byte(len(q))}, q...)); err != nil {
+		return nil, err
+	}
+	l := make([]byte, 2)
+	if _, err = io.ReadFull(conn, l); err != nil {
+		return nil, err
+	}
+	b := make([]byte, binary.BigEndian.Uint16(l))
+	_, err = io.ReadFull(conn, b)
+	return b, err
+}
+
+// addr returns the resolver's address with the default port if it doesn't have one
+func (r *Resolver) addr() string {
+	if _, _, err := net.SplitHostPort(r.Addr); err != nil {
+		return net.JoinHostPort(strings.Trim(r.Addr, "[]"), "53")
+	}
+	return r.Addr
+}
+
+func (r *Resolver) network() string {
+	if r.Net == "" {
+		return "udp"
+	}
+	return r.Net
+}
+
+// Redirected returns true if the answer is NXDOMAIN or only has ip's address
+func (a *Answer) Redirected(ip string) bool {
+	if a.NXDomain {
+		return true
+	}
+	return len(a.IPs) > 0 && matchIP(ip, a.IPs)
+}
+
+func (a *Answer) String() string {
+	switch {
+	case a.NXDomain:
+		return "NXDOMAIN"
+	case len(a.IPs) == 0:
+		return "no addresses"
+	}
+	return strings.Join(a.IPs, ", ")
+}
+
+// Sample returns up to n of the configuration's address= entries, chosen at random
+func (c Conf) Sample(n int) []string {
+	var keys []string
+	for k, h := range c {
+		if !h.Server && k != "#" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	if n < len(keys) {
+		rand.Shuffle(len(keys), func(i, j int) { keys[i], keys[j] = keys[j], keys[i] })
+		keys = keys[:n]
+		sort.Strings(keys)
+	}
+	return keys
+}
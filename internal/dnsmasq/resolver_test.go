@@ -0,0 +1,185 @@
+package dnsmasq
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// stub is an in-process DNS server answering A and AAAA queries from its zone; names that
+// aren't in the zone are NXDOMAIN and "servfail." names fail
+type stub struct {
+	truncate bool
+	zone     map[string][]string
+}
+
+func (s *stub) answer(q []byte, udp bool) []byte {
+	var m dnsmessage.Message
+	if err := m.Unpack(q); err != nil || len(m.Questions) != 1 {
+		return nil
+	}
+
+	m.Response = true
+	name := strings.TrimSuffix(m.Questions[0].Name.String(), ".")
+	switch ips, ok := s.zone[name]; {
+	case name == "servfail":
+		m.RCode = dnsmessage.RCodeServerFailure
+	case !ok:
+		m.RCode = dnsmessage.RCodeNameError
+	case udp && s.truncate:
+		m.Truncated = true
+	default:
+		for _, ip := range ips {
+			h := dnsmessage.ResourceHeader{Name: m.Questions[0].Name, Type: m.Questions[0].Type, Class: dnsmessage.ClassINET, TTL: 60}
+			switch x := net.ParseIP(ip); {
+			case h.Type == dnsmessage.TypeA && x.To4() != nil:
+				var a [4]byte
+				copy(a[:], x.To4())
+				m.Answers = append(m.Answers, dnsmessage.Resource{Header: h, Body: &dnsmessage.AResource{A: a}})
+			case h.Type == dnsmessage.TypeAAAA && x.To4() == nil:
+				var a [16]byte
+				copy(a[:], x)
+				m.Answers = append(m.Answers, dnsmessage.Resource{Header: h, Body: &dnsmessage.AAAAResource{AAAA: a}})
+			}
+		}
+	}
+
+	b, _ := m.Pack()
+	return b
+}
+
+// serve starts the stub on a UDP and a TCP socket sharing a port and returns its address
+func (s *stub) serve() (string, func()) {
+	p, err := net.ListenPacket("udp", "127.0.0.1:0")
+	So(err, ShouldBeNil)
+	l, err := net.Listen("tcp", p.LocalAddr().String())
+	So(err, ShouldBeNil)
+
+	go func() {
+		b := make([]byte, 512)
+		for {
+			n, addr, err := p.ReadFrom(b)
+			if err != nil {
+				return
+			}
+			_, _ = p.WriteTo(s.answer(b[:n], true), addr)
+		}
+	}()
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			n := make([]byte, 2)
+			if _, err = io.ReadFull(conn, n); err == nil {
+				q := make([]byte, binary.BigEndian.Uint16(n))
+				if _, err = io.ReadFull(conn, q); err == nil {
+					a := s.answer(q, false)
+					_, _ = conn.Write(append([]byte{byte(len(a) >> 8), byte(len(a))}, a...))
+				}
+			}
+			conn.Close()
+		}
+	}()
+
+	return p.LocalAddr().String(), func() { p.Close(); l.Close() }
+}
+
+func TestLookup(t *testing.T) {
+	Convey("Testing Resolver.Lookup()", t, func() {
+		s := &stub{zone: map[string][]string{
+			"blocked.com":    {"0.0.0.0"},
+			"leaked.com":     {"93.184.216.34", "93.184.216.35"},
+			"redirected.com": {"192.168.168.1"},
+			"six.com":        {"::"},
+		}}
+		addr, stop := s.serve()
+		defer stop()
+
+		tests := []struct {
+			name    string
+			exp     string
+			ip      string
+			blocked bool
+		}{
+			{name: "blocked.com", exp: "0.0.0.0", ip: "0.0.0.0", blocked: true},
+			{name: "redirected.com", exp: "192.168.168.1", ip: "192.168.168.1", blocked: true},
+			{name: "leaked.com", exp: "93.184.216.34, 93.184.216.35", ip: "0.0.0.0", blocked: false},
+			{name: "missing.com", exp: "NXDOMAIN", ip: "0.0.0.0", blocked: true},
+		}
+
+		for _, network := range []string{"udp", "tcp"} {
+			r := &Resolver{Addr: addr, Net: network}
+			for _, tt := range tests {
+				Convey("over "+network+" for "+tt.name, func() {
+					a, err := r.Lookup(tt.name)
+					So(err, ShouldBeNil)
+					So(a.String(), ShouldEqual, tt.exp)
+					So(a.Redirected(tt.ip), ShouldEqual, tt.blocked)
+				})
+			}
+		}
+
+		Convey("An AAAA query for a name redirected to an IPv6 address", func() {
+			a, err := (&Resolver{Addr: addr}).Lookup6("six.com")
+			So(err, ShouldBeNil)
+			So(a.String(), ShouldEqual, "::")
+			So(a.Redirected("::"), ShouldBeTrue)
+
+			a, err = (&Resolver{Addr: addr}).Lookup("six.com")
+			So(err, ShouldBeNil)
+			So(a.Redirected("::"), ShouldBeFalse)
+		})
+
+		Convey("A truncated UDP response is retried over TCP", func() {
+			// a separate stub, since the running one's goroutines read truncate
+			addr, stop := (&stub{truncate: true, zone: s.zone}).serve()
+			defer stop()
+			a, err := (&Resolver{Addr: addr}).Lookup("leaked.com")
+			So(err, ShouldBeNil)
+			So(a.String(), ShouldEqual, "93.184.216.34, 93.184.216.35")
+		})
+
+		Convey("A failed query is an error", func() {
+			_, err := (&Resolver{Addr: addr}).Lookup("servfail")
+			So(err.Error(), ShouldEqual, "servfail: RCodeServerFailure")
+		})
+
+		Convey("An unreachable resolver is an error", func() {
+			stop()
+			_, err := (&Resolver{Addr: addr, Net: "tcp", Timeout: 100 * time.Millisecond}).Lookup("blocked.com")
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestResolverAddr(t *testing.T) {
+	Convey("Testing Resolver addresses", t, func() {
+		So((&Resolver{Addr: "127.0.0.1"}).addr(), ShouldEqual, "127.0.0.1:53")
+		So((&Resolver{Addr: "127.0.0.1:5353"}).addr(), ShouldEqual, "127.0.0.1:5353")
+		So((&Resolver{Addr: "::1"}).addr(), ShouldEqual, "[::1]:53")
+		So((&Resolver{Addr: "[::1]:5353"}).addr(), ShouldEqual, "[::1]:5353")
+	})
+}
+
+func TestSample(t *testing.T) {
+	Convey("Testing Conf.Sample()", t, func() {
+		c := make(Conf)
+		So(c.Parse(&Mapping{Contents: []byte("address=/a.com/0.0.0.0\naddress=/b.com/0.0.0.0\naddress=/c.com/0.0.0.0\nserver=/d.com/#\naddress=/#/0.0.0.0\n")}), ShouldBeNil)
+
+		So(c.Sample(10), ShouldResemble, []string{"a.com", "b.com", "c.com"})
+		So(len(c.Sample(2)), ShouldEqual, 2)
+		for _, k := range c.Sample(2) {
+			So([]string{"a.com", "b.com", "c.com"}, ShouldContain, k)
+		}
+		So(c.Sample(0), ShouldBeEmpty)
+	})
+}
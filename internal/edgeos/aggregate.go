@@ -0,0 +1,86 @@
+package edgeos
+
+import (
+	"sort"
+	"strings"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// aggregate is the hosts node leaf that sets the aggregation threshold
+const aggregate = "aggregate"
+
+// aggregator promotes sibling hosts to a block of their registrable domain, once at
+// least threshold of them share it; it never promotes a whitelisted parent
+type aggregator struct {
+	threshold int
+	wl        *trie
+}
+
+// promotion records the hosts collapsed into a registrable domain
+type promotion struct {
+	domain string
+	hosts  int
+}
+
+// aggregator returns an *aggregator for host sources, or nil if aggregation isn't configured or
+// hosts are written in hosts format, where a promoted domain wouldn't block the hosts it replaced
+func (c *Config) aggregator() *aggregator {
+	if !c.nodeExists(hosts) || c.tree[hosts].aggregate < 1 {
+		return nil
+	}
+	if c.hostsFile(host) {
+		c.Log.Warning("hosts aggregate is ignored, since hosts are written in hosts format with the " + c.Reload + " reload strategy")
+		return nil
+	}
+
+	a := &aggregator{threshold: c.tree[hosts].aggregate, wl: newTrie()}
+	for _, n := range []string{rootNode, domains, hosts} {
+		if !c.nodeExists(n) {
+			continue
+		}
+		for _, x := range c.tree[n].exc {
+			a.wl.set([]byte(strings.ToLower(x)))
+		}
+		// a source's own excludes are whitelisted too, so no other source's promotion blocks them
+		for _, s := range c.tree[n].src {
+			for _, x := range s.exc {
+				a.wl.set([]byte(strings.ToLower(x)))
+			}
+		}
+	}
+	if c.protect != nil {
+		for _, k := range c.protect.keys() {
+			a.wl.set([]byte(k))
+		}
+	}
+	return a
+}
+
+// collapse replaces groups of threshold or more hosts sharing a registrable domain in l with
+// the domain itself, which dnsmasq blocks along with all of its subdomains, and returns the
+// promotions in domain order
+func (a *aggregator) collapse(l *list) (p []promotion) {
+	groups := make(map[string][]string)
+	for k := range l.entry {
+		d, err := publicsuffix.EffectiveTLDPlusOne(k)
+		if err != nil || d == k {
+			continue
+		}
+		groups[d] = append(groups[d], k)
+	}
+
+	for d, g := range groups {
+		if len(g) < a.threshold || a.wl.subKeyExists([]byte(d)) || a.wl.under([]byte(d)) {
+			continue
+		}
+		for _, k := range g {
+			delete(l.entry, k)
+		}
+		l.entry[d] = struct{}{}
+		p = append(p, promotion{domain: d, hosts: len(g)})
+	}
+
+	sort.Slice(p, func(i, j int) bool { return p[i].domain < p[j].domain })
+	return p
+}
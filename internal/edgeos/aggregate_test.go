@@ -0,0 +1,103 @@
+package edgeos
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCollapse(t *testing.T) {
+	Convey("Testing collapse()", t, func() {
+		a := &aggregator{threshold: 3, wl: newTrie()}
+		a.wl.set([]byte("cdn.mixed.com"))
+		a.wl.set([]byte("safe.com"))
+
+		l := list{RWMutex: &sync.RWMutex{}, entry: make(entry)}
+		for _, k := range []string{
+			"a1.tracker.com", "a2.tracker.com", "a3.tracker.com",
+			"b.two.com", "c.two.com",
+			"a.co.uk", "b.co.uk", "c.co.uk",
+			"x.ads.co.uk", "y.ads.co.uk", "z.ads.co.uk",
+			"a.mixed.com", "b.mixed.com", "c.mixed.com",
+			"a.safe.com", "b.safe.com", "c.safe.com",
+		} {
+			l.set([]byte(k))
+		}
+
+		So(a.collapse(&l), ShouldResemble, []promotion{
+			{domain: "ads.co.uk", hosts: 3},
+			{domain: "tracker.com", hosts: 3},
+		})
+		So(l.keyExists([]byte("tracker.com")), ShouldBeTrue)
+		So(l.keyExists([]byte("a1.tracker.com")), ShouldBeFalse)
+		So(l.keyExists([]byte("co.uk")), ShouldBeFalse)
+		So(l.keyExists([]byte("b.co.uk")), ShouldBeTrue)
+		So(l.keyExists([]byte("b.two.com")), ShouldBeTrue)
+		So(l.keyExists([]byte("mixed.com")), ShouldBeFalse)
+		So(l.keyExists([]byte("safe.com")), ShouldBeFalse)
+		So(len(l.entry), ShouldEqual, 13)
+	})
+
+	Convey("Testing aggregator() without a threshold", t, func() {
+		c := NewConfig()
+		So(c.Blacklist(&CFGstatic{Cfg: fmt.Sprintf(cfgAggregate, "/tmp", 0)}), ShouldBeNil)
+		So(c.aggregator(), ShouldBeNil)
+	})
+
+	Convey("Testing aggregator() with hosts format files", t, func() {
+		c := NewConfig(HostsDir("/tmp"), Logger(newLog()), Reload(sighup))
+		So(c.Blacklist(&CFGstatic{Cfg: fmt.Sprintf(cfgAggregate, "/tmp", 3)}), ShouldBeNil)
+		So(c.aggregator(), ShouldBeNil)
+	})
+}
+
+func TestAggregate(t *testing.T) {
+	Convey("Testing host aggregation in ProcessContent()", t, func() {
+		dir, err := ioutil.TempDir("/tmp", "testBlacklist")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		So(ioutil.WriteFile(dir+"/hosts.list", []byte(
+			"a1.tracker.com\na2.tracker.com\na3.tracker.com\na.mixed.com\nb.mixed.com\nc.mixed.com\na.other.com\nb.other.com\nc.other.com\nsolo.com\n",
+		), 0644), ShouldBeNil)
+
+		c := NewConfig(
+			Dir(dir),
+			Ext("blacklist.conf"),
+			FileNameFmt("%v/%v.%v.%v"),
+			Logger(newLog()),
+			Prefix("address=", "server="),
+		)
+		So(c.Blacklist(&CFGstatic{Cfg: fmt.Sprintf(cfgAggregate, dir, 3)}), ShouldBeNil)
+		So(c.aggregator().threshold, ShouldEqual, 3)
+		So(c.aggregator().wl.keyExists([]byte("cdn.other.com")), ShouldBeTrue)
+
+		ct, err := c.NewContent(FileObj)
+		So(err, ShouldBeNil)
+		So(c.ProcessContent(ct), ShouldBeNil)
+
+		act, err := ioutil.ReadFile(dir + "/hosts.trackers.blacklist.conf")
+		So(err, ShouldBeNil)
+		So(string(act), ShouldEqual, "address=/a.mixed.com/0.0.0.0\naddress=/a.other.com/0.0.0.0\naddress=/b.mixed.com/0.0.0.0\naddress=/b.other.com/0.0.0.0\naddress=/c.mixed.com/0.0.0.0\naddress=/c.other.com/0.0.0.0\naddress=/solo.com/0.0.0.0\naddress=/tracker.com/0.0.0.0\n")
+		So(c.Dex.keyExists([]byte("tracker.com")), ShouldBeTrue)
+		So(c.Boot(), ShouldContainSubstring, "aggregate 3\n")
+	})
+}
+
+var cfgAggregate = `blacklist {
+    dns-redirect-ip 0.0.0.0
+    hosts {
+        aggregate %[2]d
+        exclude cdn.mixed.com
+        source trackers {
+            exclude CDN.other.com
+            file %[1]s/hosts.list
+            prefix ""
+        }
+    }
+}
+`
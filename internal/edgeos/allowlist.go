@@ -0,0 +1,69 @@
+package edgeos
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+const (
+	allowlist = "allowlist"
+	upstream  = "upstream"
+)
+
+// allowlistFile returns the walled garden's dnsmasq configuration file name
+func (c *Config) allowlistFile() string {
+	return fmt.Sprintf(c.FnFmt, c.Dir, allowlist+"s", allowlist, c.Ext)
+}
+
+// Allowlist writes the walled garden dnsmasq configuration if the allowlist node is configured;
+// allowed domains are forwarded to the allowlist's upstream resolvers and everything else is
+// answered with its dns-redirect-ip by a catch-all address=/#/ line
+func (c *Config) Allowlist() error {
+	if !c.nodeExists(allowlist) || c.tree[allowlist].disabled {
+		return nil
+	}
+
+	a := c.tree[allowlist]
+	if len(a.upstream) == 0 {
+		return errors.New("allowlist has no upstream resolvers")
+	}
+
+	l := &list{RWMutex: &sync.RWMutex{}, entry: make(entry)}
+	for _, x := range a.inc {
+		k, err := normalize([]byte(x))
+		if err != nil {
+			c.Log.Warningf("%s: ignoring %v", allowlist, err)
+			continue
+		}
+		l.set(k)
+	}
+
+	all := c.Pfx.domain + "/#/" + c.tree.getIP(allowlist)
+	if !safeLine.MatchString(all) {
+		return fmt.Errorf("allowlist catch-all %s isn't a valid dnsmasq directive", all)
+	}
+
+	r := make([]io.Reader, 0, len(a.upstream)+1)
+	for _, u := range a.upstream {
+		r = append(r, formatData(c.Pfx.host+"/%v/"+u, l))
+	}
+	r = append(r, strings.NewReader(all+"\n"))
+
+	c.Log.Infof("%s: allowing %d domains", allowlist, len(l.entry))
+
+	b := &bList{
+		file: c.allowlistFile(),
+		r:    io.MultiReader(r...),
+		size: len(l.entry) + 1,
+	}
+	if err := b.writeFile(); err != nil {
+		return err
+	}
+	if b.wrote {
+		c.changes(b.file)
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package edgeos
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAllowlist(t *testing.T) {
+	Convey("Testing Allowlist()", t, func() {
+		dir, err := ioutil.TempDir("/tmp", "testBlacklist")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		newConfig := func(cfg string) *Config {
+			c := NewConfig(
+				Dir(dir),
+				Ext("blacklist.conf"),
+				FileNameFmt("%v/%v.%v.%v"),
+				Logger(newLog()),
+				Prefix("address=", "server="),
+			)
+			So(c.Blacklist(&CFGstatic{Cfg: cfg}), ShouldBeNil)
+			return c
+		}
+
+		Convey("Allowed domains are forwarded upstream and the rest redirected", func() {
+			c := newConfig(fmt.Sprintf(cfgAllowlist, "false"))
+			So(c.Disabled, ShouldBeFalse)
+			So(c.Allowlist(), ShouldBeNil)
+
+			act, err := ioutil.ReadFile(c.allowlistFile())
+			So(err, ShouldBeNil)
+			So(string(act), ShouldEqual, expAllowlist)
+			So(c.allowlistFile(), ShouldEqual, dir+"/allowlists.allowlist.blacklist.conf")
+		})
+
+		Convey("Testing Boot() round trip serialisation", func() {
+			c := newConfig(fmt.Sprintf(cfgAllowlist, "false"))
+			d := NewConfig()
+			So(d.Blacklist(&CFGstatic{Cfg: c.Boot()}), ShouldBeNil)
+			So(d.Boot(), ShouldEqual, c.Boot())
+			So(c.Boot(), ShouldContainSubstring, "    allowlist {\n        disabled false\n        dns-redirect-ip 192.168.1.1\n")
+		})
+
+		Convey("A disabled allowlist isn't written and doesn't disable the blacklist", func() {
+			c := newConfig(fmt.Sprintf(cfgAllowlist, "true"))
+			So(c.Disabled, ShouldBeFalse)
+			So(c.Allowlist(), ShouldBeNil)
+
+			_, err := os.Stat(c.allowlistFile())
+			So(os.IsNotExist(err), ShouldBeTrue)
+		})
+
+		Convey("An allowlist needs upstream resolvers", func() {
+			c := newConfig("blacklist {\n    allowlist {\n        include school.edu\n    }\n}\n")
+			So(c.Allowlist(), ShouldResemble, fmt.Errorf("allowlist has no upstream resolvers"))
+		})
+
+		Convey("Nothing is written without an allowlist", func() {
+			c := newConfig("blacklist {\n    dns-redirect-ip 0.0.0.0\n}\n")
+			So(c.Allowlist(), ShouldBeNil)
+
+			_, err := os.Stat(c.allowlistFile())
+			So(os.IsNotExist(err), ShouldBeTrue)
+		})
+	})
+}
+
+var (
+	cfgAllowlist = `blacklist {
+    dns-redirect-ip 0.0.0.0
+    allowlist {
+        disabled %s
+        dns-redirect-ip 192.168.1.1
+        include school.edu
+        include Kiosk.Vendor.com
+        include localhost
+        upstream 1.1.1.1
+        upstream 2606:4700:4700::1111
+    }
+}
+`
+
+	expAllowlist = `server=/kiosk.vendor.com/1.1.1.1
+server=/school.edu/1.1.1.1
+server=/kiosk.vendor.com/2606:4700:4700::1111
+server=/school.edu/2606:4700:4700::1111
+address=/#/192.168.1.1
+`
+)
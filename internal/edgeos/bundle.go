@@ -0,0 +1,282 @@
+package edgeos
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+const (
+	manifest    = "manifest.json"
+	manifestSig = manifest + ".minisig"
+	bundleDir   = "sources/"
+)
+
+// Bundle is the manifest of a source bundle: when it was created and each url source's body,
+// with when it was downloaded and its sha256 checksum
+type Bundle struct {
+	Created time.Time       `json:"created"`
+	Sources []*BundleSource `json:"sources"`
+}
+
+// BundleSource records a url source in a Bundle
+type BundleSource struct {
+	Name    string    `json:"name"`
+	URL     string    `json:"url"`
+	Fetched time.Time `json:"fetched"`
+	SHA256  string    `json:"sha256"`
+	Size    int       `json:"size"`
+}
+
+// String renders the bundle's sources, with their sizes and when they were downloaded
+func (b *Bundle) String() string {
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "source\tbytes\tfetched")
+	for _, s := range b.Sources {
+		fmt.Fprintf(w, "%s\t%d\t%s\n", s.Name, s.Size, s.Fetched.Local().Format(time.RFC3339))
+	}
+	_ = w.Flush()
+	return buf.String()
+}
+
+// Export downloads every url source and writes them to w as a gzipped tarball, with a manifest
+// signed by the key in keyFile; the key and its minisign public key, keyFile.pub, are generated
+// if keyFile doesn't exist
+func (c *Config) Export(w io.Writer, keyFile string) (*Bundle, error) {
+	id, key, err := bundleKey(keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	src := c.GetAll(urls).src
+	fetched := make([]time.Time, len(src))
+	c.parallel(len(src), func(i int) {
+		src[i].Env = c.Env
+		download(src[i])
+		fetched[i] = time.Now().UTC().Truncate(time.Second)
+	})
+
+	var (
+		b      = &Bundle{Created: time.Now().UTC().Truncate(time.Second)}
+		bodies = make([][]byte, len(src))
+	)
+	for i, s := range src {
+		if s.err != nil {
+			return nil, fmt.Errorf("unable to bundle %s.%s: %v", s.area(), s.name, s.err)
+		}
+		if bodies[i], err = ioutil.ReadAll(s.r); err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(bodies[i])
+		b.Sources = append(b.Sources, &BundleSource{
+			Name:    s.area() + "." + s.name,
+			URL:     s.url,
+			Fetched: fetched[i],
+			SHA256:  hex.EncodeToString(sum[:]),
+			Size:    len(bodies[i]),
+		})
+	}
+
+	m, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	gz := gzip.NewWriter(w)
+	t := tar.NewWriter(gz)
+	add := func(name string, body []byte) error {
+		if err := t.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(body)), ModTime: b.Created}); err != nil {
+			return err
+		}
+		_, err := t.Write(body)
+		return err
+	}
+
+	if err = add(manifest, m); err != nil {
+		return nil, err
+	}
+	if err = add(manifestSig, minisign(id, key, m)); err != nil {
+		return nil, err
+	}
+	for i, s := range b.Sources {
+		if err = add(bundleDir+s.Name, bodies[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = t.Close(); err != nil {
+		return nil, err
+	}
+	return b, gz.Close()
+}
+
+// Import reads a bundle written by Export, checks its manifest's signature against the minisign
+// public key in pubFile and its bodies' checksums, and has the url sources read their bodies from
+// it instead of downloading them. Bundles older than maxAge, or than the last bundle imported, are
+// stale and rejected. Sources that aren't in the bundle, or whose url has changed since it was
+// made, keep their previous blacklist files.
+func (c *Config) Import(r io.Reader, pubFile string, maxAge time.Duration) (*Bundle, error) {
+	pub, err := ioutil.ReadFile(pubFile)
+	if err != nil {
+		return nil, err
+	}
+
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string][]byte)
+	t := tar.NewReader(gz)
+	for {
+		h, err := t.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if files[h.Name], err = ioutil.ReadAll(t); err != nil {
+			return nil, err
+		}
+	}
+
+	m, sig := files[manifest], files[manifestSig]
+	if m == nil || sig == nil {
+		return nil, errors.New("bundle has no signed manifest")
+	}
+	if err = minisignVerify(keyLine(pub), sig, m); err != nil {
+		return nil, fmt.Errorf("bundle manifest: %v", err)
+	}
+
+	b := &Bundle{}
+	if err = json.Unmarshal(m, b); err != nil {
+		return nil, fmt.Errorf("bundle manifest: %v", err)
+	}
+
+	if c.state == nil {
+		c.state = c.loadState()
+	}
+	switch {
+	case time.Since(b.Created) > maxAge:
+		return nil, fmt.Errorf("bundle created %s is stale, it's older than %v", b.Created.Format(time.RFC3339), maxAge)
+	case c.state.Bundle != nil && b.Created.Before(*c.state.Bundle):
+		return nil, fmt.Errorf("bundle created %s is stale, a bundle created %s has been imported", b.Created.Format(time.RFC3339), c.state.Bundle.Format(time.RFC3339))
+	}
+
+	bodies := make(map[string][]byte)
+	for _, s := range b.Sources {
+		body, ok := files[bundleDir+s.Name]
+		if !ok {
+			return nil, fmt.Errorf("bundle has no body for %s", s.Name)
+		}
+		if sum := sha256.Sum256(body); hex.EncodeToString(sum[:]) != s.SHA256 {
+			return nil, fmt.Errorf("%s: sha256 checksum mismatch", s.Name)
+		}
+		bodies[s.Name+" "+s.URL] = body
+	}
+
+	c.state.Bundle = &b.Created
+	if err = c.saveState(); err != nil {
+		return nil, err
+	}
+	c.bundle = bodies
+	return b, nil
+}
+
+// Bundled returns true if the url sources are read from an imported bundle
+func (c *Config) Bundled() bool {
+	return c.bundle != nil
+}
+
+// unbundle returns the source's body from the imported bundle
+func (s *source) unbundle() *source {
+	name := s.area() + "." + s.name
+	if b, ok := s.bundle[name+" "+s.url]; ok {
+		s.Log.Info(fmt.Sprintf("Reading %s source %s from the bundle", s.area(), s.name))
+		s.r = bytes.NewReader(b)
+		return s
+	}
+
+	s.r, s.err = bytes.NewReader([]byte{}), fmt.Errorf("%s isn't in the bundle for %s, so it keeps its previous entries", name, s.url)
+	s.Log.Warning(s.err.Error())
+	return s
+}
+
+// bundleKey reads the signing key and its minisign key ID from file, generating them if it
+// doesn't exist, along with the minisign public key in file.pub
+func bundleKey(file string) ([]byte, ed25519.PrivateKey, error) {
+	b, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return newBundleKey(file)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	k, err := base64.StdEncoding.DecodeString(keyLine(b))
+	if err != nil || len(k) != 10+ed25519.PrivateKeySize || string(k[:2]) != "Ed" {
+		return nil, nil, fmt.Errorf("%s isn't a bundle signing key", file)
+	}
+	return k[2:10], ed25519.PrivateKey(k[10:]), nil
+}
+
+// newBundleKey generates a signing key, writing it to file and its minisign public key to file.pub
+func newBundleKey(file string) ([]byte, ed25519.PrivateKey, error) {
+	pub, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	id := make([]byte, 8)
+	if _, err = rand.Read(id); err != nil {
+		return nil, nil, err
+	}
+
+	write := func(f, comment string, k []byte, mode os.FileMode) error {
+		enc := base64.StdEncoding.EncodeToString(append(append([]byte("Ed"), id...), k...))
+		return ioutil.WriteFile(f, []byte("untrusted comment: "+comment+"\n"+enc+"\n"), mode)
+	}
+	if err = write(file, "blacklist bundle secret key", key, 0600); err != nil {
+		return nil, nil, err
+	}
+	if err = write(file+".pub", "blacklist bundle public key", pub, 0644); err != nil {
+		return nil, nil, err
+	}
+	return id, key, nil
+}
+
+// keyLine returns the key in a minisign key file, the line after its untrusted comment, or the
+// file's contents if it's a bare key
+func keyLine(b []byte) string {
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
+
+// minisign returns a minisign signature of body made with key, so bundles can also be checked
+// with minisign -V
+func minisign(id []byte, key ed25519.PrivateKey, body []byte) []byte {
+	h := blake2b.Sum512(body)
+	s := append(append([]byte("ED"), id...), ed25519.Sign(key, h[:])...)
+	trusted := fmt.Sprintf("timestamp:%d\tfile:%s", time.Now().Unix(), manifest)
+	g := ed25519.Sign(key, append(append([]byte{}, s[10:]...), trusted...))
+
+	return []byte(fmt.Sprintf("untrusted comment: signature from blacklist bundle key\n%s\ntrusted comment: %s\n%s\n",
+		base64.StdEncoding.EncodeToString(s), trusted, base64.StdEncoding.EncodeToString(g)))
+}
@@ -0,0 +1,174 @@
+package edgeos
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestBundle(t *testing.T) {
+	Convey("Testing Export() and Import()", t, func() {
+		dir, err := ioutil.TempDir("/tmp", "testBlacklist")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, map[string]string{"/ads": "ads.com\ntrack.com\n", "/bad": "bad.com\n"}[r.URL.Path])
+		}))
+		defer srv.Close()
+
+		newConfig := func(url string) *Config {
+			c := NewConfig(
+				Dir(dir),
+				Ext("blacklist.conf"),
+				FileNameFmt("%v/%v.%v.%v"),
+				Logger(newLog()),
+				Method("GET"),
+				Prefix("address=", "server="),
+				State(dir+"/blacklist.state.json"),
+			)
+			So(c.Blacklist(&CFGstatic{Cfg: fmt.Sprintf(cfgBundle, srv.URL, url)}), ShouldBeNil)
+			return c
+		}
+
+		var (
+			buf bytes.Buffer
+			key = dir + "/bundle.key"
+		)
+		b, err := newConfig(srv.URL+"/bad").Export(&buf, key)
+		So(err, ShouldBeNil)
+		So(len(b.Sources), ShouldEqual, 2)
+		So(b.Sources[0].Name, ShouldEqual, "domains.bad")
+		So(b.Sources[1].Name, ShouldEqual, "hosts.ads")
+		So(b.Sources[1].Size, ShouldEqual, 18)
+		So(b.String(), ShouldStartWith, "source       bytes  fetched\ndomains.bad  8      ")
+
+		_, err = os.Stat(key + ".pub")
+		So(err, ShouldBeNil)
+		bundle := buf.Bytes()
+
+		// run processes the sources from the imported bundle, as a disconnected router would
+		run := func(c *Config) {
+			for _, iface := range []IFace{URLdObj, URLhObj} {
+				ct, err := c.NewContent(iface)
+				So(err, ShouldBeNil)
+				So(ct.Len(), ShouldEqual, 0)
+			}
+			ct, err := c.NewContent(FileObj)
+			So(err, ShouldBeNil)
+			So(c.ProcessContent(ct), ShouldBeNil)
+		}
+
+		read := func(f string) string {
+			b, err := ioutil.ReadFile(dir + "/" + f)
+			So(err, ShouldBeNil)
+			return string(b)
+		}
+
+		c := newConfig(srv.URL + "/bad")
+		_, err = c.Import(bytes.NewReader(bundle), key+".pub", time.Hour)
+		So(err, ShouldBeNil)
+		So(c.Bundled(), ShouldBeTrue)
+		srv.Close()
+		run(c)
+		So(read("domains.bad.blacklist.conf"), ShouldEqual, "address=/bad.com/0.0.0.0\n")
+		So(read("hosts.ads.blacklist.conf"), ShouldEqual, "address=/ads.com/0.0.0.0\naddress=/track.com/0.0.0.0\n")
+
+		Convey("A source whose url has changed keeps its previous entries", func() {
+			c := newConfig("http://example.org/other")
+			_, err = c.Import(bytes.NewReader(bundle), key+".pub", time.Hour)
+			So(err, ShouldBeNil)
+			ct, err := c.NewContent(FileObj)
+			So(err, ShouldBeNil)
+			So(c.ProcessContent(ct), ShouldBeError, "domains.bad isn't in the bundle for http://example.org/other, so it keeps its previous entries")
+			So(read("domains.bad.blacklist.conf"), ShouldEqual, "address=/bad.com/0.0.0.0\n")
+		})
+
+		Convey("Stale bundles are rejected", func() {
+			_, err = newConfig(srv.URL+"/bad").Import(bytes.NewReader(bundle), key+".pub", -time.Second)
+			So(err.Error(), ShouldEndWith, "is stale, it's older than -1s")
+
+			So(ioutil.WriteFile(dir+"/blacklist.state.json", []byte(`{"bundle": "2999-01-01T00:00:00Z", "sources": {}}`), 0644), ShouldBeNil)
+			_, err = newConfig(srv.URL+"/bad").Import(bytes.NewReader(bundle), key+".pub", time.Hour)
+			So(err.Error(), ShouldEndWith, "is stale, a bundle created 2999-01-01T00:00:00Z has been imported")
+		})
+
+		Convey("Bundles must be signed by the key and match their manifest", func() {
+			var other bytes.Buffer
+			_, err = NewConfig(Logger(newLog())).Export(&other, dir+"/other.key")
+			So(err, ShouldBeNil)
+			_, err = newConfig(srv.URL+"/bad").Import(&other, key+".pub", time.Hour)
+			So(err, ShouldBeError, "bundle manifest: minisign signature was made with a different key")
+
+			_, err = newConfig(srv.URL+"/bad").Import(bytes.NewReader(retar(bundle, "sources/hosts.ads", "evil.com\n")), key+".pub", time.Hour)
+			So(err, ShouldBeError, "hosts.ads: sha256 checksum mismatch")
+
+			_, err = newConfig(srv.URL+"/bad").Import(bytes.NewReader(retar(bundle, manifest, strings.Replace(string(untar(bundle)[manifest]), "18", "19", 1))), key+".pub", time.Hour)
+			So(err, ShouldBeError, "bundle manifest: minisign signature verification failed")
+
+			So(ioutil.WriteFile(dir+"/bad.key", []byte("yoyo\n"), 0600), ShouldBeNil)
+			_, err = newConfig(srv.URL+"/bad").Export(&other, dir+"/bad.key")
+			So(err, ShouldBeError, dir+"/bad.key isn't a bundle signing key")
+		})
+	})
+}
+
+// untar returns the files in a bundle
+func untar(b []byte) map[string][]byte {
+	gz, err := gzip.NewReader(bytes.NewReader(b))
+	So(err, ShouldBeNil)
+	files := make(map[string][]byte)
+	t := tar.NewReader(gz)
+	for h, err := t.Next(); err == nil; h, err = t.Next() {
+		files[h.Name], _ = ioutil.ReadAll(t)
+	}
+	return files
+}
+
+// retar returns a copy of a bundle with the file name's contents replaced
+func retar(b []byte, name, body string) []byte {
+	var (
+		buf bytes.Buffer
+		gz  = gzip.NewWriter(&buf)
+		t   = tar.NewWriter(gz)
+	)
+	for _, n := range []string{manifest, manifestSig, "sources/domains.bad", "sources/hosts.ads"} {
+		f := untar(b)[n]
+		if n == name {
+			f = []byte(body)
+		}
+		So(t.WriteHeader(&tar.Header{Name: n, Mode: 0644, Size: int64(len(f))}), ShouldBeNil)
+		_, err := t.Write(f)
+		So(err, ShouldBeNil)
+	}
+	So(t.Close(), ShouldBeNil)
+	So(gz.Close(), ShouldBeNil)
+	return buf.Bytes()
+}
+
+var cfgBundle = `blacklist {
+    dns-redirect-ip 0.0.0.0
+    domains {
+        source bad {
+            prefix ""
+            url %[2]s
+        }
+    }
+    hosts {
+        source ads {
+            prefix ""
+            url %[1]s/ads
+        }
+    }
+}
+`
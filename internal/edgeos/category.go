@@ -0,0 +1,56 @@
+package edgeos
+
+import (
+	"fmt"
+
+	"github.com/britannic/blacklist/internal/catalog"
+)
+
+const category = "category"
+
+// catalog returns the catalog of curated sources, updated from the local catalog file if there is one
+func (c *Config) catalog() (*catalog.Catalog, error) {
+	return catalog.Load(c.Catalog)
+}
+
+// expand adds the curated sources in each of the root node's categories to their domains or
+// hosts node, creating the node if it isn't configured; a configured source of the same name
+// takes precedence over a curated one
+func (c *Config) expand(cat *catalog.Catalog) {
+	for _, name := range c.tree[rootNode].category {
+		for _, x := range cat.Category(name) {
+			t, ok := c.tree[x.Node]
+			if !ok {
+				t = newSource()
+				t.catalog = name
+				t.name = x.Node
+				t.nType = getType(x.Node).(ntype)
+				c.tree[x.Node] = t
+			}
+			if t.source(x.Name) != nil {
+				c.Debug(fmt.Sprintf("Keeping configured source %s over the %s catalog's", x.Name, name))
+				continue
+			}
+
+			s := newSource()
+			s.catalog = name
+			s.desc = x.Description
+			s.name = x.Name
+			s.nType = t.nType
+			s.prefix = x.Prefix
+			s.url, s.ltype = x.URL, urls
+			c.Debug(fmt.Sprintf("Adding %s catalog source %s to %s", name, s.name, x.Node))
+			t.src = append(t.src, s)
+		}
+	}
+}
+
+// source returns the named source of a domains or hosts node, or nil if it doesn't have one
+func (s *source) source(name string) *source {
+	for _, x := range s.src {
+		if x.name == name {
+			return x
+		}
+	}
+	return nil
+}
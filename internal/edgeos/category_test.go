@@ -0,0 +1,74 @@
+package edgeos
+
+import (
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestExpand(t *testing.T) {
+	Convey("Testing category expansion", t, func() {
+		c := NewConfig(Logger(newLog()))
+		So(c.Blacklist(&CFGstatic{Cfg: cfgCategory}), ShouldBeNil)
+
+		Convey("Curated sources are added to their nodes", func() {
+			So(c.GetAll(urls).Names(), ShouldResemble, sort.StringSlice{"simple_tracking", "urlhaus"})
+
+			u := c.tree[hosts].source("urlhaus")
+			So(u.catalog, ShouldEqual, "malware")
+			So(u.ltype, ShouldEqual, urls)
+			So(u.url, ShouldEqual, "https://urlhaus.abuse.ch/downloads/hostfile/")
+			So(u.ip, ShouldEqual, "0.0.0.0")
+		})
+
+		Convey("A configured source takes precedence over a curated one", func() {
+			s := c.tree[domains].source("simple_tracking")
+			So(s.catalog, ShouldBeEmpty)
+			So(s.url, ShouldEqual, "https://mirror.example.org/simple_tracking.txt")
+		})
+
+		Convey("Curated sources and nodes aren't serialised by Boot()", func() {
+			So(c.Boot(), ShouldEqual, cfgCategory)
+		})
+
+		Convey("Boot() doesn't add a prefix to sources configured without one", func() {
+			cfg := strings.Replace(cfgCategory, "            prefix \"\"\n", "", 1)
+			d := NewConfig()
+			So(d.Blacklist(&CFGstatic{Cfg: cfg}), ShouldBeNil)
+			So(d.Boot(), ShouldEqual, cfg)
+		})
+	})
+
+	Convey("Testing category expansion with a local catalog file", t, func() {
+		f, err := ioutil.TempFile("/tmp", "blacklist.catalog")
+		So(err, ShouldBeNil)
+		defer os.Remove(f.Name())
+		_, err = f.WriteString(`{"version": 99, "sources": [{"name": "bees", "category": "malware", "node": "hosts", "prefix": "0.0.0.0 ", "url": "https://bees.example.org/hosts"}]}`)
+		So(err, ShouldBeNil)
+		f.Close()
+
+		c := NewConfig(Catalog(f.Name()), Logger(newLog()))
+		So(c.Blacklist(&CFGstatic{Cfg: cfgCategory}), ShouldBeNil)
+		So(c.GetAll(urls).Names(), ShouldResemble, sort.StringSlice{"bees", "simple_tracking"})
+		So(c.tree[hosts].source("bees").prefix, ShouldEqual, "0.0.0.0 ")
+	})
+}
+
+var cfgCategory = `blacklist {
+    category malware
+    category tracking
+    disabled false
+    dns-redirect-ip 0.0.0.0
+    domains {
+        disabled false
+        source simple_tracking {
+            prefix ""
+            url https://mirror.example.org/simple_tracking.txt
+        }
+    }
+}
+`
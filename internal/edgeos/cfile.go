@@ -26,7 +26,25 @@ func (c *CFile) Remove() error {
 	if err != nil {
 		return err
 	}
-	f := diffArray(c.Names, d)
+	if c.HostsDir != "" {
+		h, err := c.readDir(fmt.Sprintf(c.FnFmt, c.HostsDir, c.Wildcard.Node, c.Wildcard.Name, hostsExt))
+		if err != nil {
+			return err
+		}
+		d = append(d, h...)
+	}
+	// only existing files can be stale; diffArray would return the longer list's extras instead
+	keep := make(map[string]bool, len(c.Names))
+	for _, x := range c.Names {
+		keep[x] = true
+	}
+	var f []string
+	for _, x := range d {
+		if !keep[x] {
+			c.changes(x)
+			f = append(f, x)
+		}
+	}
 	c.Debug(fmt.Sprintf("Removing: %v", f))
 	return purgeFiles(f)
 }
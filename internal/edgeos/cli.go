@@ -0,0 +1,174 @@
+package edgeos
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// cfgRoot is the EdgeOS configuration path to the blacklist node
+const cfgRoot = "service dns forwarding blacklist"
+
+// SourceArgs holds the settings for a new blacklist source
+type SourceArgs struct {
+	Desc   string
+	File   string
+	IP     string
+	Name   string
+	Node   string
+	Prefix string
+	URL    string
+}
+
+// cfgNode returns the configuration path for a blacklist node
+func cfgNode(node string) (string, error) {
+	switch node {
+	case "", rootNode:
+		return cfgRoot, nil
+	case domains, hosts:
+		return cfgRoot + " " + node, nil
+	}
+	return "", fmt.Errorf("invalid blacklist node %q, must be one of %s, %s or %s", node, rootNode, domains, hosts)
+}
+
+// cliQuote returns s single quoted for the EdgeOS CLI shell
+func cliQuote(s string) (string, error) {
+	if strings.ContainsAny(s, "'\n\r") {
+		return "", fmt.Errorf("value %q must not contain quotes or line breaks", s)
+	}
+	return "'" + s + "'", nil
+}
+
+// cliCmd returns a set or delete command at node; path alternates between keywords and
+// their values, e.g. "source", name, "url", url, and values are quoted
+func cliCmd(act, node string, path ...string) (string, error) {
+	p, err := cfgNode(node)
+	if err != nil {
+		return "", err
+	}
+
+	for i, e := range path {
+		if e == "" {
+			return "", fmt.Errorf("%s %s requires a value", act, strings.Join(path[:i], " "))
+		}
+		if i%2 == 1 {
+			if e, err = cliQuote(e); err != nil {
+				return "", err
+			}
+		}
+		p += " " + e
+	}
+	return act + " " + p, nil
+}
+
+// AddExclude returns the command to whitelist name on a blacklist node
+func AddExclude(node, name string) ([]string, error) {
+	return cmds(cliCmd("set", node, "exclude", name))
+}
+
+// AddInclude returns the command to blacklist name on a blacklist node
+func AddInclude(node, name string) ([]string, error) {
+	return cmds(cliCmd("set", node, "include", name))
+}
+
+// AddSource returns the commands to add a blacklist source
+func AddSource(s SourceArgs) ([]string, error) {
+	if s.Node != domains && s.Node != hosts {
+		return nil, fmt.Errorf("sources can only be added to %s or %s", domains, hosts)
+	}
+
+	switch {
+	case s.URL == "" && s.File == "":
+		return nil, errors.New("a source requires either a url or a file")
+	case s.URL != "" && s.File != "":
+		return nil, errors.New("file and url are mutually exclusive, only set one or the other")
+	}
+
+	var (
+		c    []string
+		leaf = func(name, value string) error {
+			if value == "" {
+				return nil
+			}
+			cmd, err := cliCmd("set", s.Node, src, s.Name, name, value)
+			c = append(c, cmd)
+			return err
+		}
+	)
+
+	for _, l := range [][2]string{
+		{"description", s.Desc},
+		{blackhole, s.IP},
+		{files, s.File},
+		{urls, s.URL},
+	} {
+		if err := leaf(l[0], l[1]); err != nil {
+			return nil, err
+		}
+	}
+
+	// prefix is always set, as an empty one is valid
+	cmd, err := cliCmd("set", s.Node, src, s.Name, "prefix")
+	if err != nil {
+		return nil, err
+	}
+	p, err := cliQuote(s.Prefix)
+	return append(c, cmd+" "+p), err
+}
+
+// DeleteExclude returns the command to remove a whitelisted name from a blacklist node
+func DeleteExclude(node, name string) ([]string, error) {
+	return cmds(cliCmd("delete", node, "exclude", name))
+}
+
+// DeleteInclude returns the command to remove a blacklisted name from a blacklist node
+func DeleteInclude(node, name string) ([]string, error) {
+	return cmds(cliCmd("delete", node, "include", name))
+}
+
+// DeleteSource returns the command to remove a blacklist source
+func DeleteSource(node, name string) ([]string, error) {
+	return cmds(cliCmd("delete", node, src, name))
+}
+
+// DisableSource returns the command to disable a blacklist source without removing it
+func DisableSource(node, name string) ([]string, error) {
+	return cmds(cliCmd("set", node, src, name, disabled, True))
+}
+
+// EnableSource returns the command to re-enable a disabled blacklist source
+func EnableSource(node, name string) ([]string, error) {
+	return cmds(cliCmd("delete", node, src, name, disabled))
+}
+
+func cmds(cmd string, err error) ([]string, error) {
+	if err != nil {
+		return nil, err
+	}
+	return []string{cmd}, nil
+}
+
+// commitOrDiscard saves a session's changes if they commit, or discards them and exits the CLI
+// shell with an error if they don't
+const commitOrDiscard = "if commit; then save; exit; else exit discard; exit 1; fi"
+
+// script returns a configuration session script that runs, commits and saves cmds
+func script(cmds []string) string {
+	return strings.Join(append(append([]string{"configure"}, cmds...), commitOrDiscard), "\n") + "\n"
+}
+
+// Commit applies configuration commands through the EdgeOS CLI shell, then commits and saves them
+func (c *CFGcli) Commit(cmds []string) ([]byte, error) {
+	if len(cmds) == 0 {
+		return nil, errors.New("no configuration commands to commit")
+	}
+
+	s := script(cmds)
+	c.Debug(fmt.Sprintf("Running %s with:\n%s", c.Shell, s))
+
+	// nolint
+	cmd := exec.Command(c.Shell)
+	cmd.Stdin = strings.NewReader(s)
+	return cmd.CombinedOutput()
+}
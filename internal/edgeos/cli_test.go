@@ -0,0 +1,161 @@
+package edgeos
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCLICommands(t *testing.T) {
+	Convey("Testing CLI command builders", t, func() {
+		tests := []struct {
+			err  string
+			exp  []string
+			f    func() ([]string, error)
+			name string
+		}{
+			{
+				name: "AddExclude on the root node",
+				f:    func() ([]string, error) { return AddExclude("", "good.com") },
+				exp:  []string{"set service dns forwarding blacklist exclude 'good.com'"},
+			},
+			{
+				name: "AddInclude on domains",
+				f:    func() ([]string, error) { return AddInclude(domains, "bad.com") },
+				exp:  []string{"set service dns forwarding blacklist domains include 'bad.com'"},
+			},
+			{
+				name: "AddInclude on an invalid node",
+				f:    func() ([]string, error) { return AddInclude("zones", "bad.com") },
+				err:  `invalid blacklist node "zones", must be one of blacklist, domains or hosts`,
+			},
+			{
+				name: "AddInclude without a name",
+				f:    func() ([]string, error) { return AddInclude(hosts, "") },
+				err:  "set include requires a value",
+			},
+			{
+				name: "DeleteExclude on hosts",
+				f:    func() ([]string, error) { return DeleteExclude(hosts, "good.com") },
+				exp:  []string{"delete service dns forwarding blacklist hosts exclude 'good.com'"},
+			},
+			{
+				name: "DeleteInclude with a quote",
+				f:    func() ([]string, error) { return DeleteInclude(rootNode, "bad'.com") },
+				err:  `value "bad'.com" must not contain quotes or line breaks`,
+			},
+			{
+				name: "AddSource with a url",
+				f: func() ([]string, error) {
+					return AddSource(SourceArgs{Desc: "Ads and trackers", IP: "0.0.0.0", Name: "my list", Node: hosts, URL: "http://x.com/hosts"})
+				},
+				exp: []string{
+					"set service dns forwarding blacklist hosts source 'my list' description 'Ads and trackers'",
+					"set service dns forwarding blacklist hosts source 'my list' dns-redirect-ip '0.0.0.0'",
+					"set service dns forwarding blacklist hosts source 'my list' url 'http://x.com/hosts'",
+					"set service dns forwarding blacklist hosts source 'my list' prefix ''",
+				},
+			},
+			{
+				name: "AddSource with a file",
+				f: func() ([]string, error) {
+					return AddSource(SourceArgs{File: "/config/user-data/my.list", Name: "local", Node: domains, Prefix: "address="})
+				},
+				exp: []string{
+					"set service dns forwarding blacklist domains source 'local' file '/config/user-data/my.list'",
+					"set service dns forwarding blacklist domains source 'local' prefix 'address='",
+				},
+			},
+			{
+				name: "AddSource on the root node",
+				f:    func() ([]string, error) { return AddSource(SourceArgs{Name: "local", URL: "http://x.com"}) },
+				err:  "sources can only be added to domains or hosts",
+			},
+			{
+				name: "AddSource without a url or file",
+				f:    func() ([]string, error) { return AddSource(SourceArgs{Name: "local", Node: domains}) },
+				err:  "a source requires either a url or a file",
+			},
+			{
+				name: "AddSource with a url and file",
+				f: func() ([]string, error) {
+					return AddSource(SourceArgs{File: "/tmp/a", Name: "local", Node: domains, URL: "http://x.com"})
+				},
+				err: "file and url are mutually exclusive, only set one or the other",
+			},
+			{
+				name: "AddSource without a name",
+				f:    func() ([]string, error) { return AddSource(SourceArgs{Node: domains, URL: "http://x.com"}) },
+				err:  "set source requires a value",
+			},
+			{
+				name: "DeleteSource",
+				f:    func() ([]string, error) { return DeleteSource(domains, "malc0de") },
+				exp:  []string{"delete service dns forwarding blacklist domains source 'malc0de'"},
+			},
+			{
+				name: "DisableSource",
+				f:    func() ([]string, error) { return DisableSource(hosts, "yoyo") },
+				exp:  []string{"set service dns forwarding blacklist hosts source 'yoyo' disabled 'true'"},
+			},
+			{
+				name: "EnableSource",
+				f:    func() ([]string, error) { return EnableSource(hosts, "yoyo") },
+				exp:  []string{"delete service dns forwarding blacklist hosts source 'yoyo' disabled"},
+			},
+		}
+
+		for _, tt := range tests {
+			Convey("with "+tt.name, func() {
+				act, err := tt.f()
+				if tt.err != "" {
+					So(err, ShouldNotBeNil)
+					So(err.Error(), ShouldEqual, tt.err)
+					So(act, ShouldBeNil)
+					return
+				}
+				So(err, ShouldBeNil)
+				So(act, ShouldResemble, tt.exp)
+			})
+		}
+	})
+}
+
+func TestCommit(t *testing.T) {
+	Convey("Testing Commit()", t, func() {
+		c := &CFGcli{Config: NewConfig(Shell("../testdata/fake_cli_shell.sh"))}
+
+		Convey("with a valid command", func() {
+			cmds, err := AddInclude(domains, "bad.com")
+			So(err, ShouldBeNil)
+
+			act, err := c.Commit(cmds)
+			So(err, ShouldBeNil)
+			So(string(act), ShouldEqual, "configure\nset service dns forwarding blacklist domains include 'bad.com'\ncommit\nsave\nexit\n")
+		})
+
+		Convey("with a failed commit", func() {
+			cmds, err := AddInclude(domains, "fail")
+			So(err, ShouldBeNil)
+
+			act, err := c.Commit(cmds)
+			So(err, ShouldNotBeNil)
+			So(string(act), ShouldEqual, "configure\nset service dns forwarding blacklist domains include 'fail'\ncommit\nCommit failed\nexit discard\n")
+		})
+
+		Convey("with the session script", func() {
+			So(script([]string{"set x"}), ShouldEqual, "configure\nset x\nif commit; then save; exit; else exit discard; exit 1; fi\n")
+		})
+
+		Convey("without any commands", func() {
+			_, err := c.Commit(nil)
+			So(err.Error(), ShouldEqual, "no configuration commands to commit")
+		})
+
+		Convey("with a missing shell", func() {
+			_ = c.SetOpt(Shell("/nonexistent/my_cli_shell"))
+			_, err := c.Commit([]string{"show"})
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -2,18 +2,17 @@
 package edgeos
 
 import (
-	"bufio"
-	"bytes"
 	"errors"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 
-	"github.com/britannic/blacklist/internal/regx"
+	"github.com/britannic/blacklist/internal/parse"
 )
 
 // tree is a map of top node Objects
@@ -28,6 +27,11 @@ type ConfLoader interface {
 type Config struct {
 	*Env
 	tree
+	exempt  *trie
+	options []string
+	protect *trie
+	report  Report
+	state   *state
 }
 
 type ctr struct {
@@ -39,6 +43,7 @@ type stat map[string]*stats
 type stats struct {
 	dropped   int32
 	extracted int32
+	invalid   int32
 	kept      int32
 }
 
@@ -52,6 +57,7 @@ const (
 	hosts     = "hosts"
 	notknown  = "unknown"
 	preNoun   = "pre-configured"
+	priority  = "priority"
 	roots     = "roots"
 	rootNode  = "blacklist"
 	src       = "source"
@@ -160,12 +166,13 @@ func (c *Config) addInc(n string) *source {
 }
 
 // GetTotalStats displays aggregate statistics for processed sources
-func (c *Config) GetTotalStats() (dropped, extracted, kept int32) {
+func (c *Config) GetTotalStats() (dropped, extracted, invalid, kept int32) {
 	ctr := c.ctr.stat
 	for k := range ctr {
-		if ctr[k].kept+ctr[k].dropped != 0 {
+		if ctr[k].kept+ctr[k].dropped+ctr[k].invalid != 0 {
 			dropped += ctr[k].dropped
 			extracted += ctr[k].extracted
+			invalid += ctr[k].invalid
 			kept += ctr[k].kept
 		}
 	}
@@ -175,7 +182,7 @@ func (c *Config) GetTotalStats() (dropped, extracted, kept int32) {
 	// 	c.Log.Noticef("Total entries extracted %d", kept)
 	// 	c.Log.Noticef("Total entries dropped %d", dropped)
 	// }
-	return dropped, extracted, kept
+	return dropped, extracted, invalid, kept
 }
 
 // NewContent returns a Contenter interface of the requested IFace type
@@ -188,6 +195,9 @@ func (c *Config) NewContent(iface IFace) (Contenter, error) {
 	case ExRtObj:
 		return &ExcRootObjects{Objects: c.addExc(rootNode)}, nil
 	case FileObj:
+		if c.Bundled() {
+			return &FIODataObjects{Objects: c.GetAll(files, urls)}, nil
+		}
 		return &FIODataObjects{Objects: c.GetAll(iface.String())}, nil
 	case PreDObj:
 		return &PreDomnObjects{Objects: c.GetAll(iface.String())}, nil
@@ -196,8 +206,14 @@ func (c *Config) NewContent(iface IFace) (Contenter, error) {
 	case PreHObj:
 		return &PreHostObjects{Objects: c.GetAll(iface.String())}, nil
 	case URLdObj:
+		if c.Bundled() || c.offline {
+			return &URLDomnObjects{Objects: &Objects{Env: c.Env}}, nil
+		}
 		return &URLDomnObjects{Objects: c.Get(domains).Filter(urls)}, nil
 	case URLhObj:
+		if c.Bundled() || c.offline {
+			return &URLHostObjects{Objects: &Objects{Env: c.Env}}, nil
+		}
 		return &URLHostObjects{Objects: c.Get(hosts).Filter(urls)}, nil
 	}
 	return nil, errors.New("invalid interface requested")
@@ -226,6 +242,23 @@ func (c *Config) GetAll(ltypes ...string) *Objects {
 	return o
 }
 
+// Files returns the blacklist files the configuration writes, so the others are stale: its
+// sources' files and, if they're enabled, the allowlist and safe search files
+func (c *Config) Files() *CFile {
+	f := c.GetAll().Files()
+	if c.Disabled {
+		return f
+	}
+	if c.nodeExists(allowlist) && !c.tree[allowlist].disabled {
+		f.Names = append(f.Names, c.allowlistFile())
+	}
+	if c.nodeExists(safeSearch) && !c.tree[safeSearch].disabled {
+		f.Names = append(f.Names, c.SafeSearchFile())
+	}
+	sort.Strings(f.Names)
+	return f
+}
+
 // InSession returns true if VyOS/EdgeOS configure is in session
 func (c *Config) InSession() bool {
 	return os.ExpandEnv("$_OFR_CONFIGURE") == "ok"
@@ -259,49 +292,6 @@ func (c *Config) Nodes() (n []string) {
 	return n
 }
 
-// isTnode returns true if node is a root or top node in the blacklist configuration
-func isTnode(n string) bool {
-	switch n {
-	case rootNode, domains, hosts:
-		return true
-	}
-	return false
-}
-
-func (c *Config) excinc(t [][]byte, n string) {
-	switch string(t[1]) {
-	case "exclude":
-		if isTnode(n) {
-			c.Debug("Whitelisting %s on node %s", string(t[2]), n)
-			c.tree[n].exc = append(c.tree[n].exc, string(t[2]))
-		}
-	case "include":
-		if isTnode(n) {
-			c.Debug("Blacklisting %s on node %s", string(t[2]), n)
-			c.tree[n].inc = append(c.tree[n].inc, string(t[2]))
-		}
-	}
-}
-
-func (c *Config) label(name [][]byte, o *source, n string) {
-	switch string(name[1]) {
-	case "description":
-		o.desc = string(name[2])
-	case blackhole:
-		o.ip = string(name[2])
-	case files:
-		o.file = string(name[2])
-		o.ltype = string(name[1])
-		c.tree[n].src = append(c.tree[n].src, o)
-	case "prefix":
-		o.prefix = string(name[2])
-	case urls:
-		o.ltype = string(name[1])
-		o.url = string(name[2])
-		c.tree[n].src = append(c.tree[n].src, o)
-	}
-}
-
 // mode returns a contextual VYOS API argument
 func (c *Config) mode() string {
 	if c.InSession() {
@@ -310,68 +300,89 @@ func (c *Config) mode() string {
 	return ""
 }
 
-func (c *Config) addTnodeSource(n string) {
-	if isTnode(n) {
-		c.tree[n] = newSource()
-		c.tree[n].name = n
-		c.tree[n].nType = getType(n).(ntype)
-	}
-}
+// ProcessContent processes the Contents array in three stages: sources are parsed
+// concurrently, merged one at a time in priority order, then written concurrently, so
+// the output is the same from run to run
+func (c *Config) ProcessContent(cts ...Contenter) error {
+	var errs []string
 
-func (c *Config) disable(line []byte, n string, find *regx.OBJ) {
-	if isTnode(n) {
-		c.tree[n].disabled, _ = strToBool(string(find.SubMatch(regx.DSBL, line)[1]))
-		c.Env.Disabled = c.tree[n].disabled
+	if len(cts) < 1 {
+		return errors.New("empty Contenter interface{} passed to ProcessContent()")
 	}
-}
 
-func (c *Config) redirect(line []byte, n string, find *regx.OBJ) {
-	if isTnode(n) {
-		c.tree[n].ip = string(find.SubMatch(regx.IPBH, line)[1])
+	var srcs []*source
+	for _, ct := range cts {
+		srcs = append(srcs, ct.GetList().src...)
 	}
-}
+	sortSources(srcs)
 
-func (c *Config) sourcename(o *source, line []byte, n string, find *regx.OBJ) {
-	if isTnode(n) {
-		name := find.SubMatch(regx.NAME, line)
-		if o != nil {
-			c.label(name, o, n)
+	c.ctr.Lock()
+	for _, s := range srcs {
+		if _, ok := c.ctr.stat[typeInt(s.nType)]; !ok {
+			c.ctr.stat[typeInt(s.nType)] = &stats{}
 		}
 	}
-}
+	c.ctr.Unlock()
 
-// ProcessContent processes the Contents array
-func (c *Config) ProcessContent(cts ...Contenter) error {
-	var (
-		errs []string
-		wg   sync.WaitGroup
-	)
+	ps := make([]*parsed, len(srcs))
+	c.parallel(len(srcs), func(i int) { ps[i] = srcs[i].parse() })
 
-	if len(cts) < 1 {
-		return errors.New("empty Contenter interface{} passed to ProcessContent()")
+	if c.state == nil {
+		c.state = c.loadState()
+	}
+	c.allowed()
+
+	agg := c.aggregator()
+	rules := c.dnsmasqRules()
+	h := c.fingerprint(rules)
+	bl := make([]*bList, len(ps))
+	for i, p := range ps {
+		// a tripped source isn't written, so its previous output stays in place
+		why := c.guard(p)
+		sum := chain(h, p, why != "")
+		if why != "" {
+			c.Log.Warningf("%s.%s: keeping previous output, %s", p.area(), p.name, why)
+			bl[i] = &bList{}
+			continue
+		}
+		if agg != nil && p.nType == host && (p.ltype == files || p.ltype == urls) {
+			p.agg = agg
+		}
+		p.exempt, p.protect = c.exempt, c.protect
+		p.rules = rules
+		bl[i] = p.merge()
+		bl[i].sum, bl[i].prev = sum, c.state.Inputs[bl[i].file]
+		c.conflicted(p)
 	}
 
-	for _, ct := range cts {
-		for _, s := range ct.GetList().src {
-			if s.err != nil {
-				errs = append(errs, s.err.Error())
-			}
-			wg.Add(1)
-
-			go func(s *source) {
-				s.ctr.Lock()
-				s.ctr.stat[typeInt(s.nType)] = &stats{}
-				s.ctr.Unlock()
-
-				if err := s.process().writeFile(); err != nil {
-					errs = append(errs, err.Error())
-				}
-				wg.Done()
-			}(s)
+	if err := c.addnHostsConf(); err != nil {
+		errs = append(errs, err.Error())
+	}
+
+	werrs := make([]error, len(bl))
+	c.parallel(len(bl), func(i int) { werrs[i] = bl[i].writeFile() })
+
+	for i, b := range bl {
+		if b.wrote {
+			c.changes(b.file)
+		}
+		if werrs[i] == nil && b.size > 0 {
+			c.state.Inputs[b.file] = b.sum
 		}
 	}
 
-	wg.Wait()
+	if err := c.saveState(); err != nil {
+		c.Log.Warningf("Unable to save state file %s: %v", c.State, err)
+	}
+
+	for i, s := range srcs {
+		if s.err != nil {
+			errs = append(errs, s.err.Error())
+		}
+		if werrs[i] != nil {
+			errs = append(errs, werrs[i].Error())
+		}
+	}
 
 	if errs != nil {
 		return errors.New(strings.Join(errs, "\n"))
@@ -380,70 +391,138 @@ func (c *Config) ProcessContent(cts ...Contenter) error {
 	return nil
 }
 
-// Blacklist extracts blacklist nodes from a EdgeOS/VyOS configuration structure
-func (c *Config) Blacklist(r ConfLoader) error {
+// parallel calls f for 0 to n-1 on up to Cores goroutines and waits for them to finish
+func (c *Config) parallel(n int, f func(i int)) {
 	var (
-		b     = bufio.NewScanner(r.read())
-		find  = regx.NewRegex()
-		nodes []string
-		o     *source
-		tnode string
+		cores = c.Cores
+		wg    sync.WaitGroup
 	)
 
-	for b.Scan() {
-		line := bytes.TrimSpace(b.Bytes())
-		c.Debug(fmt.Sprintf("%s\n", string(line)))
-		switch {
-		case find.RX[regx.MLTI].Match(line): // add include/exclude
-			c.Debug(fmt.Sprintf("Adding incExc to %s: %s\n", tnode, string(line)))
-			c.excinc(find.SubMatch(regx.MLTI, line), tnode)
-		case find.RX[regx.NODE].Match(line): // add tnode
-			tnode = string(find.SubMatch(regx.NODE, line)[1])
-			nodes = append(nodes, tnode)
-			c.Debug(fmt.Sprintf("Adding %s node: %s\n", tnode, string(line)))
-			c.addTnodeSource(tnode)
-		case find.RX[regx.LEAF].Match(line): // add source to root/domains/hosts
-			c.Debug(fmt.Sprintf("Adding leaf to %s: %s\n", tnode, string(line)))
-			srcName := find.SubMatch(regx.LEAF, line)
-			nodes = append(nodes, string(srcName[1]))
-			o = newSource()
-			o.addSource(srcName, tnode)
-		case find.RX[regx.DSBL].Match(line): // add disable blacklist flag
-			c.Debug(fmt.Sprintf("Adding disable flag to %s: %s\n", tnode, string(line)))
-			c.disable(line, tnode, find)
-		case find.RX[regx.IPBH].Match(line) && isntSource(nodes): // add blackhole IP
-			c.Debug(fmt.Sprintf("Adding blackhole IP to %s: %s\n", tnode, string(line)))
-			c.redirect(line, tnode, find)
-		case find.RX[regx.NAME].Match(line): // add source name
-			c.Debug(fmt.Sprintf("Adding source to %s: %s\n", tnode, string(line)))
-			c.sourcename(o, line, tnode, find)
-		case find.RX[regx.RBRC].Match(line): // found closing bracket
-			if len(nodes) > 1 {
-				c.Debug(fmt.Sprintf("Matching closing bracket: %s\n", string(line)))
-				nodes = nodes[:len(nodes)-1] // pop last node
-				tnode = nodes[len(nodes)-1]  // capture top node
+	if cores < 1 {
+		cores = 1
+	}
+	sem := make(chan struct{}, cores)
+
+	for i := range Iter(n) {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			f(i)
+			<-sem
+		}(i)
+	}
+	wg.Wait()
+}
+
+// Blacklist extracts blacklist nodes from a EdgeOS/VyOS configuration structure
+func (c *Config) Blacklist(r ConfLoader) error {
+	root, err := parse.Parse(r.read())
+	if err != nil {
+		c.Debug(fmt.Sprintf("Configuration syntax errors:\n%v", err))
+	}
+
+	b := root.Find(rootNode)
+	if b == nil {
+		return errors.New("no blacklist configuration has been detected")
+	}
+
+	c.addTnode(b)
+	for _, n := range b.Children {
+		switch n.Name {
+		case allowlist, connectivity, domains, hosts, safeSearch:
+			if n.Block {
+				c.addTnode(n)
 			}
 		}
 	}
 
-	if len(c.tree) < 1 {
-		return errors.New("no blacklist configuration has been detected")
+	cat, err := c.catalog()
+	if err != nil {
+		c.Debug(fmt.Sprintf("Using the built in catalog, because %v", err))
 	}
+	c.expand(cat)
+
+	c.protect = protected(root, c.tree[rootNode])
+	c.options = root.Values(options...)
 
 	c.Debug(fmt.Sprintf("Using router configuration %v", c.String()))
 
 	return nil
 }
 
-// ReloadDNS reloads the dnsmasq configuration
-func (c *Config) ReloadDNS() ([]byte, error) {
-	// nolint
-	bcmd := c.Bash
-	dnssvc := c.DNSsvc
-	c = nil // workaround to release memory for ER-X
-	cmd := exec.Command(bcmd)
-	cmd.Stdin = strings.NewReader(dnssvc)
-	return cmd.CombinedOutput()
+// addTnode adds a root, domains or hosts node and its sources to the tree
+func (c *Config) addTnode(n *parse.Node) {
+	t := newSource()
+	t.name = n.Name
+	t.nType = getType(n.Name).(ntype)
+	c.tree[n.Name] = t
+	c.Debug(fmt.Sprintf("Adding %s node from line %d", n.Name, n.Line))
+
+	for _, l := range n.Children {
+		switch l.Name {
+		case aggregate:
+			t.aggregate, _ = strconv.Atoi(l.Value)
+		case disabled:
+			t.disabled, _ = strToBool(l.Value)
+			// the allowlist, connectivity check and safe search are disabled on their own
+			if n.Name != allowlist && n.Name != connectivity && n.Name != safeSearch {
+				c.Env.Disabled = t.disabled
+			}
+		case blackhole:
+			t.ip = l.Value
+		case category:
+			t.category = append(t.category, l.Value)
+		case method:
+			t.method = l.Value
+		case conflicts:
+			t.conflict = l.Value
+		case "exclude":
+			c.Debug(fmt.Sprintf("Whitelisting %s on node %s", l.Value, n.Name))
+			t.exc = append(t.exc, l.Value)
+		case family:
+			t.family = l.Value
+		case "include":
+			c.Debug(fmt.Sprintf("Blacklisting %s on node %s", l.Value, n.Name))
+			t.inc = append(t.inc, l.Value)
+		case probe:
+			t.probe = append(t.probe, l.Value)
+		case protect:
+			t.protect = append(t.protect, l.Value)
+		case unprotect:
+			t.unprotect = append(t.unprotect, l.Value)
+		case upstream:
+			t.upstream = append(t.upstream, l.Value)
+		case redirect:
+			if t.redirect == nil {
+				t.redirect = make(map[string]string)
+			}
+			for _, v := range l.Values(target) {
+				t.redirect[l.Value] = v
+			}
+		case src:
+			if s := newSourceNode(l, n.Name); s != nil {
+				c.Debug(fmt.Sprintf("Adding source %s to %s", s.name, n.Name))
+				t.src = append(t.src, s)
+			}
+		}
+	}
+}
+
+// Boot returns the blacklist configuration tree serialised in config.boot syntax
+func (c *Config) Boot() string {
+	if !c.nodeExists(rootNode) {
+		return ""
+	}
+
+	b := c.tree[rootNode].node(rootNode, "")
+	for _, n := range []string{allowlist, connectivity, domains, hosts, safeSearch} {
+		// nodes only created for curated sources aren't configured
+		if c.nodeExists(n) && c.tree[n].catalog == "" {
+			b.Children = append(b.Children, c.tree[n].node(n, ""))
+		}
+	}
+	return b.String()
 }
 
 // sortKeys returns a slice of keys in lexicographical sorted order.
@@ -500,13 +579,17 @@ func (c tree) getIP(node string) string {
 }
 
 func (c tree) validate(node string) *Objects {
+	o := &Objects{}
 	if c.keyExists(node) {
-		for _, o := range c[node].src {
-			if o.ip == "" {
-				o.ip = c.getIP(node)
+		for _, s := range c[node].src {
+			if s.disabled {
+				continue
 			}
+			if s.ip == "" {
+				s.ip = c.getIP(node)
+			}
+			o.src = append(o.src, s)
 		}
-		return &c[node].Objects
 	}
-	return &Objects{}
+	return o
 }
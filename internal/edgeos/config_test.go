@@ -6,6 +6,7 @@ import (
 	"io"
 	"io/ioutil"
 	"os"
+	"sort"
 	"sync"
 	"testing"
 	"time"
@@ -43,15 +44,15 @@ func TestAddInc(t *testing.T) {
 						Bash:  "",
 						Cores: 0,
 						Dbug:  false,
-						Dex: &list{
+						Dex: &trie{
 							RWMutex: &sync.RWMutex{},
-							entry:   entry{},
+							root:    &tnode{},
 						},
 						Dir:    "",
 						DNSsvc: "",
-						Exc: &list{
+						Exc: &trie{
 							RWMutex: &sync.RWMutex{},
-							entry:   entry{},
+							root:    &tnode{},
 						},
 						Ext:   "",
 						File:  "",
@@ -98,15 +99,15 @@ func TestAddInc(t *testing.T) {
 						Bash:  "",
 						Cores: 0,
 						Dbug:  false,
-						Dex: &list{
+						Dex: &trie{
 							RWMutex: &sync.RWMutex{},
-							entry:   entry{},
+							root:    &tnode{},
 						},
 						Dir:    "",
 						DNSsvc: "",
-						Exc: &list{
+						Exc: &trie{
 							RWMutex: &sync.RWMutex{},
-							entry:   entry{},
+							root:    &tnode{},
 						},
 						Ext:   "",
 						File:  "",
@@ -152,15 +153,15 @@ func TestAddInc(t *testing.T) {
 						Bash:  "",
 						Cores: 0,
 						Dbug:  false,
-						Dex: &list{
+						Dex: &trie{
 							RWMutex: &sync.RWMutex{},
-							entry:   entry{},
+							root:    &tnode{},
 						},
 						Dir:    "",
 						DNSsvc: "",
-						Exc: &list{
+						Exc: &trie{
 							RWMutex: &sync.RWMutex{},
-							entry:   entry{},
+							root:    &tnode{},
 						},
 						Ext:   "",
 						File:  "",
@@ -361,12 +362,6 @@ func TestInSession(t *testing.T) {
 	})
 }
 
-func TestIsSource(t *testing.T) {
-	Convey("Testing TestIsSource()", t, func() {
-		var node []string
-		So(isntSource(node), ShouldBeTrue)
-	})
-}
 func TestNodeExists(t *testing.T) {
 	Convey("Testing TestNodeExists()", t, func() {
 		var (
@@ -421,6 +416,83 @@ func TestReadCfg(t *testing.T) {
 	})
 }
 
+func TestReadQuotedCfg(t *testing.T) {
+	Convey("Testing Blacklist() with quoted braces, multi-line descriptions and comments", t, func() {
+		c := NewConfig()
+		So(c.Blacklist(&CFGstatic{Cfg: cfgQuoted}), ShouldBeNil)
+		So(c.Nodes(), ShouldResemble, []string{"blacklist", "hosts"})
+		So(c.tree[hosts].inc, ShouldResemble, []string{"ads.example.com"})
+
+		s := c.tree[hosts].src
+		So(len(s), ShouldEqual, 2)
+		So(s[0].name, ShouldEqual, "yoyo")
+		So(s[0].desc, ShouldEqual, "Braces { in } quotes\nand a second line")
+		So(s[0].prefix, ShouldEqual, "")
+		So(s[1].name, ShouldEqual, "my list")
+		So(s[1].file, ShouldEqual, "/config/user-data/my.list")
+		So(s[1].ltype, ShouldEqual, files)
+
+		Convey("Testing Boot() round trip serialisation", func() {
+			So(c.Boot(), ShouldEqual, expBoot)
+
+			d := NewConfig()
+			So(d.Blacklist(&CFGstatic{Cfg: c.Boot()}), ShouldBeNil)
+			So(d.String(), ShouldEqual, c.String())
+			So(d.Boot(), ShouldEqual, c.Boot())
+		})
+	})
+}
+
+func TestPerSourceCfg(t *testing.T) {
+	Convey("Testing per-source disabled, include and exclude", t, func() {
+		dir, err := ioutil.TempDir("/tmp", "testBlacklist")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		So(ioutil.WriteFile(dir+"/noisy.list", []byte("zone ads.com\nzone cdn.good.com\nzone track.com\n"), 0644), ShouldBeNil)
+
+		c := NewConfig(
+			Dir(dir),
+			Ext("blacklist.conf"),
+			FileNameFmt("%v/%v.%v.%v"),
+			Logger(newLog()),
+			Prefix("address=", "server="),
+		)
+		So(c.Blacklist(&CFGstatic{Cfg: fmt.Sprintf(cfgPerSource, dir)}), ShouldBeNil)
+
+		s := c.tree[domains].src
+		So(len(s), ShouldEqual, 2)
+		So(s[0].disabled, ShouldBeFalse)
+		So(s[0].exc, ShouldResemble, []string{"good.com"})
+		So(s[0].inc, ShouldResemble, []string{"extra.com"})
+		So(s[1].disabled, ShouldBeTrue)
+
+		Convey("Disabled sources are skipped", func() {
+			So(c.Get(domains).Names(), ShouldResemble, sort.StringSlice{"blacklisted-subdomains", "noisy"})
+			So(c.GetAll().Files().Strings(), ShouldNotContain, dir+"/domains.paused.blacklist.conf")
+			So(c.GetAll().Files().Strings(), ShouldContain, dir+"/domains.noisy.blacklist.conf")
+		})
+
+		Convey("Source includes and excludes only apply to their own source", func() {
+			ct, err := c.NewContent(FileObj)
+			So(err, ShouldBeNil)
+			So(c.ProcessContent(ct), ShouldBeNil)
+
+			act, err := ioutil.ReadFile(dir + "/domains.noisy.blacklist.conf")
+			So(err, ShouldBeNil)
+			So(string(act), ShouldEqual, "address=/ads.com/0.0.0.0\naddress=/extra.com/0.0.0.0\naddress=/track.com/0.0.0.0\n")
+			So(c.Exc.keyExists([]byte("good.com")), ShouldBeFalse)
+		})
+
+		Convey("Testing Boot() round trip serialisation", func() {
+			d := NewConfig()
+			So(d.Blacklist(&CFGstatic{Cfg: c.Boot()}), ShouldBeNil)
+			So(d.Boot(), ShouldEqual, c.Boot())
+			So(d.Boot(), ShouldContainSubstring, "source paused {\n            disabled true\n")
+		})
+	})
+}
+
 func TestReadUnconfiguredCfg(t *testing.T) {
 	Convey("Testing ReadCfg()", t, func() {
 		exp := errors.New("no blacklist configuration has been detected")
@@ -434,6 +506,19 @@ func TestReloadDNS(t *testing.T) {
 		act, err := NewConfig(Bash("/bin/bash"), DNSsvc("true")).ReloadDNS()
 		So(err, ShouldBeNil)
 		So(string(act), ShouldEqual, "")
+
+		_, err = NewConfig(DNSsvc("false")).ReloadDNS()
+		So(err, ShouldNotBeNil)
+
+		_, err = NewConfig().ReloadDNS()
+		So(err, ShouldBeError, "no dnsmasq restart command has been set")
+
+		c := NewConfig(Dir("/tmp"), DNSsvc("false"), Logger(newLog()), Reload(sighup))
+		c.changes("/tmp/hosts/hosts.ads.hosts")
+		c.changes(c.addnHosts())
+		So(c.confs, ShouldResemble, []string{c.addnHosts()})
+		_, err = c.ReloadDNS()
+		So(err, ShouldNotBeNil)
 	})
 }
 
@@ -558,6 +643,31 @@ func TestValidate(t *testing.T) {
 }
 
 var (
+	cfgPerSource = `service {
+    dns {
+        forwarding {
+            blacklist {
+                disabled false
+                dns-redirect-ip 0.0.0.0
+                domains {
+                    source noisy {
+                        exclude good.com
+                        file %[1]s/noisy.list
+                        include extra.com
+                        prefix zone
+                    }
+                    source paused {
+                        disabled true
+                        file %[1]s/noisy.list
+                        prefix zone
+                    }
+                }
+            }
+        }
+    }
+}
+`
+
 	expDomainObj = `
 Desc:         "pre-configured blacklisted subdomains"
 Disabled:     "false"
@@ -1147,5 +1257,50 @@ Whitelist:
               "**No entries found**"
 Blacklist:
               "**No entries found**"
+`
+
+	cfgQuoted = `service {
+    dns {
+        forwarding {
+            blacklist {
+                dns-redirect-ip 0.0.0.0
+                /* hosts { include bogus.example.com } */
+                hosts {
+                    include ads.example.com
+                    source yoyo {
+                        description "Braces { in } quotes
+and a second line"
+                        prefix ""
+                        url https://pgl.yoyo.org/as/serverlist.php?hostformat=nohtml
+                    }
+                    source "my list" {
+                        file /config/user-data/my.list
+                    }
+                    source incomplete {
+                        description "Neither a url nor a file"
+                    }
+                }
+            }
+        }
+    }
+}`
+
+	expBoot = `blacklist {
+    disabled false
+    dns-redirect-ip 0.0.0.0
+    hosts {
+        disabled false
+        include ads.example.com
+        source yoyo {
+            description "Braces { in } quotes
+and a second line"
+            prefix ""
+            url https://pgl.yoyo.org/as/serverlist.php?hostformat=nohtml
+        }
+        source "my list" {
+            file /config/user-data/my.list
+        }
+    }
+}
 `
 )
@@ -0,0 +1,149 @@
+package edgeos
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/britannic/blacklist/internal/dnsmasq"
+)
+
+const (
+	conflicts = "conflicts"
+	exclude   = "exclude"
+	warn      = "warn"
+)
+
+// options is the path of the router's own dnsmasq options
+var options = []string{"service", "dns", "forwarding", "options"}
+
+// rules maps the domains that existing dnsmasq rules resolve, rather than block, to the rule
+type rules struct {
+	exclude bool
+	domain  map[string]string
+}
+
+// dnsmasqRules returns the domains resolved by dnsmasq rules that the blacklist didn't write: the
+// router's dnsmasq options and the other files in the dnsmasq directory, e.g. a server= to an
+// internal DNS server or an address= for a local host
+func (c *Config) dnsmasqRules() *rules {
+	r := &rules{domain: make(map[string]string)}
+	if c.nodeExists(rootNode) {
+		r.exclude = c.tree[rootNode].conflict == exclude
+	}
+
+	add := func(conf dnsmasq.Conf, origin string) {
+		for _, k := range conf.Keys() {
+			h := conf[k]
+			if k == "#" || !resolves(h) || c.ownHosts(h.File) {
+				continue
+			}
+			o := origin
+			if h.File != "" {
+				o = h.File
+			}
+			r.domain[k] = fmt.Sprintf("%s (%s)", rule(k, h), o)
+		}
+	}
+
+	conf := make(dnsmasq.Conf)
+	if err := conf.Parse(&dnsmasq.Mapping{Contents: []byte(strings.Join(c.options, "\n"))}); err != nil {
+		c.Debug(fmt.Sprintf("Unable to parse the dnsmasq options: %v", err))
+	}
+	add(conf, strings.Join(options, " "))
+
+	if c.Dir == "" {
+		return r
+	}
+	files, err := ioutil.ReadDir(c.Dir)
+	if err != nil {
+		c.Debug(fmt.Sprintf("Unable to read %s: %v", c.Dir, err))
+		return r
+	}
+
+	mask := fmt.Sprintf(c.FnFmt, c.Dir, "*", "*", c.Ext)
+	for _, f := range files {
+		name := filepath.Join(c.Dir, f.Name())
+		if ok, _ := filepath.Match(mask, name); ok || name == c.addnHosts() || f.IsDir() || !strings.HasSuffix(name, ".conf") {
+			continue
+		}
+		conf, err := dnsmasq.Load(name)
+		if err != nil {
+			c.Debug(fmt.Sprintf("Unable to parse %s: %v", name, err))
+			continue
+		}
+		add(conf, name)
+	}
+	return r
+}
+
+// ownHosts returns true if file is one of the blacklist's hosts format files, which an addn-hosts
+// directive may include
+func (c *Config) ownHosts(file string) bool {
+	return c.HostsDir != "" && strings.HasPrefix(file, filepath.Clean(c.HostsDir)+string(filepath.Separator))
+}
+
+// resolves returns true if a dnsmasq rule forwards a domain or answers it with a real address
+func resolves(h dnsmasq.Host) bool {
+	if h.Server {
+		return h.IP != ""
+	}
+	ip := net.ParseIP(h.IP)
+	return ip != nil && !ip.IsUnspecified() && !ip.IsLoopback()
+}
+
+// rule returns a dnsmasq rule in its configuration syntax
+func rule(k string, h dnsmasq.Host) string {
+	if h.Server {
+		return fmt.Sprintf("server=/%s/%s", k, h.IP)
+	}
+	return fmt.Sprintf("address=/%s/%s", k, h.IP)
+}
+
+// find returns the rule that resolves fqdn or one of its parent domains, or "" if there isn't one
+func (r *rules) find(fqdn []byte) string {
+	if r == nil || len(r.domain) == 0 {
+		return ""
+	}
+	for d := string(fqdn); ; {
+		if x, ok := r.domain[d]; ok {
+			return x
+		}
+		i := strings.IndexByte(d, '.')
+		if i < 0 {
+			return ""
+		}
+		d = d[i+1:]
+	}
+}
+
+// overrides records fqdn as a conflict if blocking it overrides an existing dnsmasq rule that
+// resolves it, and returns true if conflicts are excluded
+func (p *parsed) overrides(fqdn []byte) bool {
+	r := p.rules.find(fqdn)
+	if r == "" {
+		return false
+	}
+	p.conflicts = append(p.conflicts, fmt.Sprintf("%s conflicts with %s", fqdn, r))
+	return p.rules.exclude
+}
+
+// conflicted records a parsed source's conflicts in the run report
+func (c *Config) conflicted(p *parsed) {
+	if len(p.conflicts) == 0 {
+		return
+	}
+	sort.Strings(p.conflicts)
+
+	name := p.area() + "." + p.name
+	for _, s := range c.report {
+		if s.Name == name {
+			s.Conflicts = p.conflicts
+			return
+		}
+	}
+	c.report = append(c.report, &SourceReport{Name: name, Entries: len(p.fqdns), Conflicts: p.conflicts})
+}
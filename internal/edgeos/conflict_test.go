@@ -0,0 +1,148 @@
+package edgeos
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/britannic/blacklist/internal/dnsmasq"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestConflicts(t *testing.T) {
+	Convey("Testing conflicts with existing dnsmasq rules in ProcessContent()", t, func() {
+		dir, err := ioutil.TempDir("/tmp", "testBlacklist")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		files := map[string]string{
+			"domains.list":                 "corp.lan\nads.com\n",
+			"hosts.list":                   "ads.corp.lan\nnas.home\nblocked.tracker.org\nwiki.internal.org\ntrack.com\n",
+			"local.conf":                   "server=/corp.lan/10.0.0.1\naddress=/nas.home/192.168.1.10\naddress=/blocked.tracker.org/0.0.0.0\n",
+			"domains.stale.blacklist.conf": "server=/track.com/10.0.0.9\n",
+		}
+		for f, s := range files {
+			So(ioutil.WriteFile(dir+"/"+f, []byte(s), 0644), ShouldBeNil)
+		}
+
+		run := func(action string) *Config {
+			c := NewConfig(
+				Dir(dir),
+				Ext("blacklist.conf"),
+				FileNameFmt("%v/%v.%v.%v"),
+				Logger(newLog()),
+				Prefix("address=", "server="),
+			)
+			So(c.Blacklist(&CFGstatic{Cfg: fmt.Sprintf(cfgConflicts, dir, action)}), ShouldBeNil)
+
+			ct, err := c.NewContent(FileObj)
+			So(err, ShouldBeNil)
+			So(c.ProcessContent(ct), ShouldBeNil)
+			return c
+		}
+
+		read := func(f string) string {
+			b, err := ioutil.ReadFile(dir + "/" + f)
+			So(err, ShouldBeNil)
+			return string(b)
+		}
+
+		Convey("Conflicts are blocked and reported by default", func() {
+			c := run("warn")
+			So(read("domains.lan.blacklist.conf"), ShouldEqual, "address=/ads.com/0.0.0.0\naddress=/corp.lan/0.0.0.0\n")
+			So(read("hosts.home.blacklist.conf"), ShouldEqual, "address=/blocked.tracker.org/0.0.0.0\naddress=/nas.home/0.0.0.0\naddress=/track.com/0.0.0.0\naddress=/wiki.internal.org/0.0.0.0\n")
+			So(c.Report().String(), ShouldEqual, fmt.Sprintf(expConflicts, dir))
+		})
+
+		Convey("Conflicts are excluded and reported", func() {
+			c := run("exclude")
+			So(read("domains.lan.blacklist.conf"), ShouldEqual, "address=/ads.com/0.0.0.0\n")
+			So(read("hosts.home.blacklist.conf"), ShouldEqual, "address=/blocked.tracker.org/0.0.0.0\naddress=/track.com/0.0.0.0\n")
+			So(c.Report()[0].Conflicts, ShouldResemble, []string{
+				"corp.lan conflicts with server=/corp.lan/10.0.0.1 (" + dir + "/local.conf)",
+			})
+		})
+	})
+
+	Convey("Testing dnsmasqRules() skips the blacklist's own hosts format files", t, func() {
+		dir, err := ioutil.TempDir("/tmp", "testBlacklist")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		hostsDir := dir + "/hosts"
+		So(os.Mkdir(hostsDir, 0755), ShouldBeNil)
+
+		for f, s := range map[string]string{
+			"/blacklist.addn-hosts.conf":  "addn-hosts=" + hostsDir + "\n",
+			"/local.conf":                 "addn-hosts=" + hostsDir + "\naddress=/nas.home/192.168.1.10\n",
+			"/hosts/hosts.ads.hosts":      "192.168.1.254 ads.com\n",
+			"/domains.ads.blacklist.conf": "address=/bad.com/192.168.1.254\n",
+		} {
+			So(ioutil.WriteFile(dir+f, []byte(s), 0644), ShouldBeNil)
+		}
+
+		c := NewConfig(
+			Dir(dir),
+			Ext("blacklist.conf"),
+			FileNameFmt("%v/%v.%v.%v"),
+			HostsDir(hostsDir),
+			Logger(newLog()),
+			Reload(sighup),
+		)
+		So(c.Blacklist(&CFGstatic{Cfg: fmt.Sprintf(cfgConflicts, dir, "exclude")}), ShouldBeNil)
+		So(c.dnsmasqRules().domain, ShouldResemble, map[string]string{
+			"internal.org": "server=/internal.org/10.0.0.2 (service dns forwarding options)",
+			"nas.home":     "address=/nas.home/192.168.1.10 (" + dir + "/local.conf)",
+		})
+	})
+
+	Convey("Testing resolves()", t, func() {
+		for h, exp := range map[dnsmasq.Host]bool{
+			{IP: "10.0.0.1", Server: true}: true,
+			{IP: "#", Server: true}:        true,
+			{Server: true}:                 false,
+			{IP: "192.168.1.10"}:           true,
+			{IP: "0.0.0.0"}:                false,
+			{IP: "::"}:                     false,
+			{IP: "127.0.0.1"}:              false,
+			{}:                             false,
+		} {
+			So(resolves(h), ShouldEqual, exp)
+		}
+	})
+}
+
+var (
+	cfgConflicts = `service {
+    dns {
+        forwarding {
+            blacklist {
+                conflicts %[2]s
+                dns-redirect-ip 0.0.0.0
+                domains {
+                    source lan {
+                        file %[1]s/domains.list
+                        prefix ""
+                    }
+                }
+                hosts {
+                    source home {
+                        file %[1]s/hosts.list
+                        prefix ""
+                    }
+                }
+            }
+            options "server=/internal.org/10.0.0.2"
+        }
+    }
+}
+`
+
+	expConflicts = `source       previous  entries  status
+domains.lan  0         2        applied
+hosts.home   0         5        applied
+domains.lan: corp.lan conflicts with server=/corp.lan/10.0.0.1 (%[1]s/local.conf)
+hosts.home: nas.home conflicts with address=/nas.home/192.168.1.10 (%[1]s/local.conf)
+hosts.home: wiki.internal.org conflicts with server=/internal.org/10.0.0.2 (service dns forwarding options)
+`
+)
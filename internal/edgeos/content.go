@@ -1,6 +1,7 @@
 package edgeos
 
 import (
+	"bytes"
 	"io"
 )
 
@@ -25,9 +26,12 @@ const (
 )
 
 type bList struct {
-	file string
-	r    io.Reader
-	size int
+	file  string
+	prev  string // sum when the file was last written
+	r     io.Reader
+	size  int
+	sum   string // hash of the inputs the file is generated from
+	wrote bool
 }
 
 // Contenter is an interface for handling the different file/http data sources
@@ -223,14 +227,25 @@ func (e *ExcRootObjects) GetList() *Objects {
 	return e.Objects
 }
 
-// GetList implements the Contenter interface for FIODataObjects
+// GetList implements the Contenter interface for FIODataObjects; url sources are read from the
+// imported bundle
 func (f *FIODataObjects) GetList() *Objects {
 	var responses = make(chan *source, len(f.src))
 
 	for _, s := range f.src {
 		s.Env = f.Env
 		go func(s *source) {
+			if s.ltype == urls {
+				responses <- s.unbundle()
+				return
+			}
 			s.r, s.err = GetFile(s.file)
+			if s.err == nil && s.signed() {
+				if s.r, s.err = s.verified(s.r); s.err != nil {
+					s.Log.Warning(s.err.Error())
+					s.r = bytes.NewReader([]byte{})
+				}
+			}
 			responses <- s
 		}(s)
 	}
@@ -407,7 +407,7 @@ func TestNewContent(t *testing.T) {
 
 		So(c.Blacklist(&CFGstatic{Cfg: Cfg}), ShouldBeNil)
 
-		c.Dex.merge(&list{RWMutex: &sync.RWMutex{}, entry: entry{"amazon-de.com": struct{}{}}})
+		c.Dex.set([]byte("amazon-de.com"))
 		So(c.Dex.String(), ShouldEqual, `"amazon-de.com":{},
 `)
 
@@ -592,6 +592,7 @@ func TestProcessContent(t *testing.T) {
 			tests := []struct {
 				dropped   int32
 				extracted int32
+				invalid   int32
 				kept      int32
 				err       error
 				exp       string
@@ -791,7 +792,18 @@ Blacklist:
               "intellitxt.com"
               "kiosked.com"
 `,
-					expDexMap: list{entry: entry{}},
+					expDexMap: list{
+						entry: entry{
+							"adsrvr.org":         struct{}{},
+							"adtechus.net":       struct{}{},
+							"advertising.com":    struct{}{},
+							"centade.com":        struct{}{},
+							"doubleclick.net":    struct{}{},
+							"free-counter.co.uk": struct{}{},
+							"intellitxt.com":     struct{}{},
+							"kiosked.com":        struct{}{},
+						},
+					},
 					expExcMap: list{
 						entry: entry{
 							"adsrvr.org":         struct{}{},
@@ -871,7 +883,7 @@ address=/really.bad.phishing.site.ru/10.10.10.10
 						})
 					}
 
-					dropped, extracted, kept := c.GetTotalStats()
+					dropped, extracted, invalid, kept := c.GetTotalStats()
 
 					Convey("Dropped entries should match", func() {
 						So(dropped, ShouldEqual, tt.dropped)
@@ -881,6 +893,10 @@ address=/really.bad.phishing.site.ru/10.10.10.10
 						So(extracted, ShouldEqual, tt.extracted)
 					})
 
+					Convey("Invalid entries should match", func() {
+						So(invalid, ShouldEqual, tt.invalid)
+					})
+
 					Convey("Kept entries should match", func() {
 						So(kept, ShouldEqual, tt.kept)
 					})
@@ -888,11 +904,11 @@ address=/really.bad.phishing.site.ru/10.10.10.10
 					switch tt.f {
 					case "":
 						Convey("Testing "+tt.name+" ProcessContent(): Dex map should match expected", func() {
-							So(c.Dex.entry, ShouldResemble, tt.expDexMap.entry)
+							So(c.Dex.String(), ShouldEqual, tt.expDexMap.String())
 						})
 
 						Convey("Testing "+tt.name+" ProcessContent(): Exc map should match expected", func() {
-							So(c.Exc.entry, ShouldResemble, tt.expExcMap.entry)
+							So(c.Exc.String(), ShouldEqual, tt.expExcMap.String())
 						})
 
 						Convey("Testing "+tt.name+" ProcessContent(): ct should match expected", func() {
@@ -915,6 +931,114 @@ address=/really.bad.phishing.site.ru/10.10.10.10
 	})
 }
 
+func TestProcessContentDeterministic(t *testing.T) {
+	Convey("Testing ProcessContent() output is identical across runs", t, func() {
+		src, err := ioutil.TempDir("/tmp", "testBlacklist")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(src)
+
+		for f, data := range map[string]string{
+			"a.list": "ads.com\nshared.com\ntrack.com\nsub.domain.com\n",
+			"b.list": "shared.com\ntrack.com\nmore.com\n",
+			"c.list": "domain.com\nshared.com\n",
+			"d.list": "x.domain.com\nmore.com\nlast.com\n",
+		} {
+			So(ioutil.WriteFile(src+"/"+f, []byte(data), 0644), ShouldBeNil)
+		}
+
+		run := func(cores int) (map[string]string, [3]int32) {
+			dir, err := ioutil.TempDir("/tmp", "testBlacklist")
+			So(err, ShouldBeNil)
+			defer os.RemoveAll(dir)
+
+			c := NewConfig(
+				Cores(cores),
+				Dir(dir),
+				Ext("blacklist.conf"),
+				FileNameFmt("%v/%v.%v.%v"),
+				Logger(newLog()),
+				Prefix("address=", "server="),
+			)
+			So(c.Blacklist(&CFGstatic{Cfg: fmt.Sprintf(cfgDeterministic, src)}), ShouldBeNil)
+
+			var cts []Contenter
+			for _, o := range []IFace{PreRObj, PreDObj, PreHObj, ExRtObj, ExDmObj, ExHtObj, FileObj} {
+				ct, err := c.NewContent(o)
+				So(err, ShouldBeNil)
+				cts = append(cts, ct)
+			}
+			So(c.ProcessContent(cts...), ShouldBeNil)
+
+			out := make(map[string]string)
+			files, err := ioutil.ReadDir(dir)
+			So(err, ShouldBeNil)
+			for _, f := range files {
+				b, err := ioutil.ReadFile(dir + "/" + f.Name())
+				So(err, ShouldBeNil)
+				out[f.Name()] = string(b)
+			}
+
+			dropped, extracted, _, kept := c.GetTotalStats()
+			return out, [3]int32{dropped, extracted, kept}
+		}
+
+		exp, expStats := run(1)
+		So(exp, ShouldResemble, map[string]string{
+			"domains.blacklisted-subdomains.blacklist.conf": "address=/pre.com/0.0.0.0\n",
+			"domains.gamma.blacklist.conf":                  "address=/domain.com/0.0.0.0\naddress=/shared.com/0.0.0.0\n",
+			"hosts.alpha.blacklist.conf":                    "address=/ads.com/0.0.0.0\naddress=/track.com/0.0.0.0\n",
+			"hosts.beta.blacklist.conf":                     "address=/more.com/0.0.0.0\n",
+			"hosts.delta.blacklist.conf":                    "address=/last.com/0.0.0.0\n",
+		})
+		So(expStats, ShouldResemble, [3]int32{6, 13, 7})
+
+		for _, cores := range []int{1, 2, 4, 8} {
+			for range Iter(5) {
+				act, stats := run(cores)
+				So(act, ShouldResemble, exp)
+				So(stats, ShouldResemble, expStats)
+			}
+		}
+	})
+}
+
+func TestProcessContentIncludes(t *testing.T) {
+	Convey("Testing ProcessContent() drops entries under included domains", t, func() {
+		dir, err := ioutil.TempDir("/tmp", "testBlacklist")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		So(ioutil.WriteFile(dir+"/d.list", []byte("x.inc.com\nother.com\n"), 0644), ShouldBeNil)
+		So(ioutil.WriteFile(dir+"/h.list", []byte("a.inc.com\nb.root.com\nkeep.com\n"), 0644), ShouldBeNil)
+
+		c := NewConfig(
+			Dir(dir),
+			Ext("blacklist.conf"),
+			FileNameFmt("%v/%v.%v.%v"),
+			Logger(newLog()),
+			Prefix("address=", "server="),
+		)
+		So(c.Blacklist(&CFGstatic{Cfg: fmt.Sprintf(cfgIncludes, dir)}), ShouldBeNil)
+
+		var cts []Contenter
+		for _, o := range []IFace{PreRObj, PreDObj, FileObj} {
+			ct, err := c.NewContent(o)
+			So(err, ShouldBeNil)
+			cts = append(cts, ct)
+		}
+		So(c.ProcessContent(cts...), ShouldBeNil)
+
+		for f, exp := range map[string]string{
+			"domains.d.blacklist.conf": "address=/other.com/0.0.0.0\n",
+			"hosts.h.blacklist.conf":   "address=/keep.com/0.0.0.0\n",
+		} {
+			act, err := ioutil.ReadFile(dir + "/" + f)
+			So(err, ShouldBeNil)
+			So(string(act), ShouldEqual, exp)
+		}
+	})
+}
+
 func TestProcessZeroContent(t *testing.T) {
 	Convey("Testing ProcessZeroContent()", t, func() {
 		dir, err := ioutil.TempDir("/tmp", "testBlacklist")
@@ -940,12 +1064,16 @@ func TestProcessZeroContent(t *testing.T) {
 			So(err, ShouldBeNil)
 		}
 
-		dropped, extracted, kept := c.GetTotalStats()
+		dropped, extracted, invalid, kept := c.GetTotalStats()
 
 		Convey("Dropped entries should match", func() {
 			So(dropped, ShouldEqual, 1)
 		})
 
+		Convey("Invalid entries should match", func() {
+			So(invalid, ShouldEqual, 0)
+		})
+
 		Convey("Extracted entries should match", func() {
 			So(extracted, ShouldEqual, 2)
 		})
@@ -1039,6 +1167,51 @@ func TestWriteFile(t *testing.T) {
 }
 
 var (
+	cfgIncludes = `blacklist {
+    dns-redirect-ip 0.0.0.0
+    include root.com
+    domains {
+        include inc.com
+        source d {
+            file %[1]s/d.list
+            prefix ""
+        }
+    }
+    hosts {
+        source h {
+            file %[1]s/h.list
+            prefix ""
+        }
+    }
+}
+`
+
+	cfgDeterministic = `blacklist {
+    dns-redirect-ip 0.0.0.0
+    domains {
+        include pre.com
+        source gamma {
+            file %[1]s/c.list
+            prefix ""
+        }
+    }
+    hosts {
+        source alpha {
+            file %[1]s/a.list
+            prefix ""
+        }
+        source beta {
+            file %[1]s/b.list
+            prefix ""
+        }
+        source delta {
+            file %[1]s/d.list
+            prefix ""
+        }
+    }
+}
+`
+
 	// Cfg contains a valid full EdgeOS blacklist configuration
 	Cfg = `blacklist {
     disabled false
@@ -1466,7 +1639,7 @@ Blacklist:
 
 	filesMin = "[\nDesc:\t \"File source\"\nDisabled: false\nFile:\t \"../../internal/testdata/blist.hosts.src\"\nIP:\t \"10.10.10.10\"\nLtype:\t \"file\"\nName:\t \"tasty\"\nnType:\t \"host\"\nPrefix:\t \"\"\nType:\t \"hosts\"\nURL:\t \"\"\n \nDesc:\t \"File source\"\nDisabled: false\nFile:\t \"../../internal/testdata/blist.hosts.src\"\nIP:\t \"10.10.10.10\"\nLtype:\t \"file\"\nName:\t \"/tasty\"\nnType:\t \"host\"\nPrefix:\t \"\"\nType:\t \"hosts\"\nURL:\t \"\"\n]"
 
-	excRootContent = "server=/122.2o7.net/#\nserver=/1e100.net/#\nserver=/adobedtm.com/#\nserver=/akamai.net/#\nserver=/amazon.com/#\nserver=/amazonaws.com/#\nserver=/apple.com/#\nserver=/ask.com/#\nserver=/avast.com/#\nserver=/bitdefender.com/#\nserver=/cdn.visiblemeasures.com/#\nserver=/cloudfront.net/#\nserver=/coremetrics.com/#\nserver=/edgesuite.net/#\nserver=/freedns.afraid.org/#\nserver=/github.com/#\nserver=/githubusercontent.com/#\nserver=/google.com/#\nserver=/googleadservices.com/#\nserver=/googleapis.com/#\nserver=/googleusercontent.com/#\nserver=/gstatic.com/#\nserver=/gvt1.com/#\nserver=/gvt1.net/#\nserver=/hb.disney.go.com/#\nserver=/hp.com/#\nserver=/hulu.com/#\nserver=/images-amazon.com/#\nserver=/jumptap.com/#\nserver=/msdn.com/#\nserver=/paypal.com/#\nserver=/rackcdn.com/#\nserver=/schema.org/#\nserver=/skype.com/#\nserver=/smacargo.com/#\nserver=/sourceforge.net/#\nserver=/ssl-on9.com/#\nserver=/ssl-on9.net/#\nserver=/static.chartbeat.com/#\nserver=/storage.googleapis.com/#\nserver=/usemaxserver.de/#\nserver=/windows.net/#\nserver=/yimg.com/#\nserver=/ytimg.com/#"
+	excRootContent = "server=/122.2o7.net/#\nserver=/1e100.net/#\nserver=/adobedtm.com/#\nserver=/akamai.net/#\nserver=/amazon.com/#\nserver=/amazonaws.com/#\nserver=/apple.com/#\nserver=/ask.com/#\nserver=/avast.com/#\nserver=/bitdefender.com/#\nserver=/cdn.visiblemeasures.com/#\nserver=/cloudfront.net/#\nserver=/coremetrics.com/#\nserver=/edgesuite.net/#\nserver=/freedns.afraid.org/#\nserver=/github.com/#\nserver=/githubusercontent.com/#\nserver=/google.com/#\nserver=/googleadservices.com/#\nserver=/googleapis.com/#\nserver=/googleusercontent.com/#\nserver=/gstatic.com/#\nserver=/gvt1.com/#\nserver=/gvt1.net/#\nserver=/hb.disney.go.com/#\nserver=/hp.com/#\nserver=/hulu.com/#\nserver=/images-amazon.com/#\nserver=/jumptap.com/#\nserver=/msdn.com/#\nserver=/paypal.com/#\nserver=/rackcdn.com/#\nserver=/schema.org/#\nserver=/skype.com/#\nserver=/smacargo.com/#\nserver=/sourceforge.net/#\nserver=/ssl-on9.com/#\nserver=/ssl-on9.net/#\nserver=/static.chartbeat.com/#\nserver=/usemaxserver.de/#\nserver=/windows.net/#\nserver=/yimg.com/#\nserver=/ytimg.com/#"
 
 	testCfg = `blacklist {
 	disabled false
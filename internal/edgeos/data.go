@@ -68,16 +68,23 @@ func formatData(s string, l *list) io.Reader {
 	s += "\n"
 	l.RLock()
 	for k := range (*l).entry {
-		a[i] = fmt.Sprintf(s, k)
-		i++
+		// never write anything but an address= or server= line for a valid domain
+		if line := fmt.Sprintf(s, k); safeLine.MatchString(strings.TrimSuffix(line, "\n")) {
+			a[i] = line
+			i++
+		}
 	}
 	(*l).RUnlock()
+	a = a[:i]
 	a.Sort()
 	return strings.NewReader(strings.Join(a, ""))
 }
 
 // getDnsmasqPrefix returns the dnsmasq conf file delimiter
 func getDnsmasqPrefix(s *source) string {
+	if s.hostsFile(s.nType) {
+		return s.ip + " %v"
+	}
 	switch s.nType {
 	case domn, preDomn, preRoot, root:
 		return s.Pfx.domain + "/%v/" + s.ip
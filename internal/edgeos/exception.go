@@ -0,0 +1,122 @@
+package edgeos
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Allow records a temporary exception for name in the state file, until d from now, and rewrites
+// the blacklist files that block it without the entries that do; it returns the files rewritten,
+// so dnsmasq only needs reloading if there are any. Runs before the exception expires don't block
+// name either, and the first run after it expires blocks it again.
+func (c *Config) Allow(name string, d time.Duration) ([]string, error) {
+	if c.State == "" {
+		return nil, errors.New("temporary exceptions need a state file")
+	}
+	if d <= 0 {
+		return nil, fmt.Errorf("exception for %s must last longer than %v", name, d)
+	}
+
+	k, err := normalize([]byte(name))
+	if err != nil {
+		return nil, fmt.Errorf("%s is not a valid domain: %v", name, err)
+	}
+
+	c.state = c.loadState()
+	c.state.Allowed[string(k)] = time.Now().Add(d).UTC().Truncate(time.Second)
+
+	allowed := newTrie()
+	allowed.set(k)
+
+	files, err := c.blacklistFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	var rewritten []string
+	for _, f := range files {
+		ok, err := unblock(f, allowed)
+		if err != nil {
+			c.saveState()
+			return rewritten, err
+		}
+		if ok {
+			// the file no longer matches its inputs' sum, so the run after the exception expires
+			// rewrites it
+			delete(c.state.Inputs, f)
+			c.changes(f)
+			rewritten = append(rewritten, f)
+		}
+	}
+	return rewritten, c.saveState()
+}
+
+// allowed adds the unexpired temporary exceptions to the protected names and the exempt names,
+// so neither they nor their subdomains are blocked
+func (c *Config) allowed() {
+	c.exempt = nil
+	if len(c.state.Allowed) == 0 {
+		return
+	}
+	if c.protect == nil {
+		c.protect = newTrie()
+	}
+	c.exempt = newTrie()
+	for k := range c.state.Allowed {
+		c.protect.set([]byte(k))
+		c.exempt.set([]byte(k))
+	}
+}
+
+// unblock rewrites a blacklist file without the entries blocking an allowed name or its
+// subdomains, returning true if it had any
+func unblock(file string, allowed *trie) (bool, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return false, err
+	}
+
+	var (
+		keep    []string
+		lines   = strings.Split(string(b), "\n")
+		removed bool
+	)
+	for _, l := range lines {
+		// entries are address=/domain/ip, server=/domain/ or, in hosts format, ip domain
+		f := strings.Split(l, "/")
+		if len(f) < 3 {
+			f = strings.Fields(l)
+		}
+		if len(f) > 1 {
+			if k := []byte(strings.ToLower(f[1])); allowed.under(k) || allowed.subKeyExists(k) {
+				removed = true
+				continue
+			}
+		}
+		keep = append(keep, l)
+	}
+
+	if !removed {
+		return false, nil
+	}
+	return true, ioutil.WriteFile(file, []byte(strings.Join(keep, "\n")), 0644)
+}
+
+// exceptions renders the temporary exceptions, soonest to expire first
+func exceptions(m map[string]time.Time) []string {
+	s := make([]string, 0, len(m))
+	for k := range m {
+		s = append(s, k)
+	}
+	sort.Slice(s, func(i, j int) bool {
+		if !m[s[i]].Equal(m[s[j]]) {
+			return m[s[i]].Before(m[s[j]])
+		}
+		return s[i] < s[j]
+	})
+	return s
+}
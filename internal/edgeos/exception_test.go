@@ -0,0 +1,113 @@
+package edgeos
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAllow(t *testing.T) {
+	Convey("Testing Allow()", t, func() {
+		dir, err := ioutil.TempDir("/tmp", "testBlacklist")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		newConfig := func() *Config {
+			return NewConfig(
+				Dir(dir),
+				Ext("blacklist.conf"),
+				FileNameFmt("%v/%v.%v.%v"),
+				Logger(newLog()),
+				Prefix("address=", "server="),
+				State(dir+"/blacklist.state.json"),
+			)
+		}
+
+		So(ioutil.WriteFile(dir+"/domains.parent.blacklist.conf", []byte("address=/ads.com/0.0.0.0\naddress=/other.com/0.0.0.0\n"), 0644), ShouldBeNil)
+		So(ioutil.WriteFile(dir+"/hosts.exact.blacklist.conf", []byte("address=/x.ads.com/0.0.0.0\n"), 0644), ShouldBeNil)
+		So(ioutil.WriteFile(dir+"/hosts.other.blacklist.conf", []byte("address=/y.ads.com/0.0.0.0\n"), 0644), ShouldBeNil)
+		So(ioutil.WriteFile(dir+"/hosts.sub.blacklist.conf", []byte("address=/keep.com/0.0.0.0\naddress=/www.x.ads.com/0.0.0.0\n"), 0644), ShouldBeNil)
+
+		c := newConfig()
+		act, err := c.Allow("X.ads.com", 30*time.Minute)
+		So(err, ShouldBeNil)
+		So(act, ShouldResemble, []string{dir + "/domains.parent.blacklist.conf", dir + "/hosts.exact.blacklist.conf", dir + "/hosts.sub.blacklist.conf"})
+
+		b, err := ioutil.ReadFile(dir + "/domains.parent.blacklist.conf")
+		So(err, ShouldBeNil)
+		So(string(b), ShouldEqual, "address=/other.com/0.0.0.0\n")
+		b, err = ioutil.ReadFile(dir + "/hosts.other.blacklist.conf")
+		So(err, ShouldBeNil)
+		So(string(b), ShouldEqual, "address=/y.ads.com/0.0.0.0\n")
+		b, err = ioutil.ReadFile(dir + "/hosts.sub.blacklist.conf")
+		So(err, ShouldBeNil)
+		So(string(b), ShouldEqual, "address=/keep.com/0.0.0.0\n")
+
+		exp := c.state.Allowed["x.ads.com"]
+		So(exp, ShouldHappenWithin, time.Minute, time.Now().Add(30*time.Minute))
+		So(newConfig().Status(), ShouldEqual, fmt.Sprintf("source  entries\n\nexception  expires\nx.ads.com  %s\n", exp.Local().Format(time.RFC3339)))
+
+		Convey("Runs before it expires don't block it or its subdomains", func() {
+			So(ioutil.WriteFile(dir+"/hosts.list", []byte("x.ads.com\ny.ads.com\nz.ads.com\nwww.x.ads.com\n"), 0644), ShouldBeNil)
+			c := newConfig()
+			So(c.Blacklist(&CFGstatic{Cfg: fmt.Sprintf(cfgGuard, dir)}), ShouldBeNil)
+			ct, err := c.NewContent(FileObj)
+			So(err, ShouldBeNil)
+			So(c.ProcessContent(ct), ShouldBeNil)
+
+			b, err := ioutil.ReadFile(dir + "/hosts.guarded.blacklist.conf")
+			So(err, ShouldBeNil)
+			So(string(b), ShouldEqual, "address=/y.ads.com/0.0.0.0\naddress=/z.ads.com/0.0.0.0\n")
+		})
+
+		Convey("An expired exception is dropped", func() {
+			So(ioutil.WriteFile(dir+"/blacklist.state.json", []byte(`{"allowed": {"x.ads.com": "2020-01-01T00:00:00Z"}, "sources": {"hosts.guarded": 3}}`), 0644), ShouldBeNil)
+			So(newConfig().loadState().Allowed, ShouldBeEmpty)
+			So(newConfig().Status(), ShouldEqual, "source         entries\nhosts.guarded  3\n\nexception  expires\n")
+		})
+
+		Convey("The first run after it expires blocks it again", func() {
+			So(ioutil.WriteFile(dir+"/hosts.list", []byte("x.ads.com\ny.ads.com\nz.ads.com\n"), 0644), ShouldBeNil)
+			run := func() string {
+				c := newConfig()
+				So(c.Blacklist(&CFGstatic{Cfg: fmt.Sprintf(cfgGuard, dir)}), ShouldBeNil)
+				ct, err := c.NewContent(FileObj)
+				So(err, ShouldBeNil)
+				So(c.ProcessContent(ct), ShouldBeNil)
+				b, err := ioutil.ReadFile(dir + "/hosts.guarded.blacklist.conf")
+				So(err, ShouldBeNil)
+				return string(b)
+			}
+
+			So(ioutil.WriteFile(dir+"/blacklist.state.json", []byte(`{"sources": {}}`), 0644), ShouldBeNil)
+			all := "address=/x.ads.com/0.0.0.0\naddress=/y.ads.com/0.0.0.0\naddress=/z.ads.com/0.0.0.0\n"
+			So(run(), ShouldEqual, all)
+
+			_, err := newConfig().Allow("x.ads.com", time.Minute)
+			So(err, ShouldBeNil)
+			b, err := ioutil.ReadFile(dir + "/hosts.guarded.blacklist.conf")
+			So(err, ShouldBeNil)
+			So(string(b), ShouldEqual, "address=/y.ads.com/0.0.0.0\naddress=/z.ads.com/0.0.0.0\n")
+			So(newConfig().loadState().Inputs, ShouldNotContainKey, dir+"/hosts.guarded.blacklist.conf")
+
+			c := newConfig()
+			c.state = c.loadState()
+			c.state.Allowed["x.ads.com"] = time.Now().Add(-time.Second)
+			So(c.saveState(), ShouldBeNil)
+			So(run(), ShouldEqual, all)
+		})
+
+		Convey("Problems are errors", func() {
+			_, err := c.Allow("x.ads.com", 0)
+			So(err, ShouldBeError, "exception for x.ads.com must last longer than 0s")
+			_, err = c.Allow("10.0.0.1", time.Minute)
+			So(err, ShouldNotBeNil)
+			_, err = NewConfig(Logger(newLog())).Allow("x.ads.com", time.Minute)
+			So(err, ShouldBeError, "temporary exceptions need a state file")
+		})
+	})
+}
@@ -0,0 +1,48 @@
+package edgeos
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"sort"
+)
+
+// fingerprint returns a hash of the inputs besides the sources' entries that the blacklist files
+// depend on: the configuration, the protected names and temporary exceptions, and the existing
+// dnsmasq rules
+func (c *Config) fingerprint(r *rules) hash.Hash {
+	h := sha256.New()
+	io.WriteString(h, c.Boot())
+	fmt.Fprintf(h, "%s %s\n", c.Pfx.domain, c.Pfx.host)
+	if c.protect != nil {
+		io.WriteString(h, c.protect.String())
+	}
+
+	if r != nil {
+		keys := make([]string, 0, len(r.domain))
+		for k := range r.domain {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		fmt.Fprintf(h, "exclude %t\n", r.exclude)
+		for _, k := range keys {
+			fmt.Fprintf(h, "%s %s\n", k, r.domain[k])
+		}
+	}
+	return h
+}
+
+// chain adds a parsed source's entries to h, which already holds those of the sources merged
+// before it, since the entries they keep are dropped from it; a tripped source isn't merged,
+// which changes what later sources keep too
+func chain(h hash.Hash, p *parsed, tripped bool) string {
+	fmt.Fprintf(h, "%s.%s %t\n", p.area(), p.name, tripped)
+	for _, f := range p.fqdns {
+		h.Write(f)
+		h.Write([]byte{'\n'})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,196 @@
+package edgeos
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestIncremental(t *testing.T) {
+	Convey("Testing incremental regeneration", t, func() {
+		dir, err := ioutil.TempDir("/tmp", "testBlacklist")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		var (
+			first  = dir + "/hosts.first.blacklist.conf"
+			second = dir + "/hosts.second.blacklist.conf"
+			marker = "# untouched\n"
+		)
+
+		list := func(name string, entries ...string) {
+			So(ioutil.WriteFile(dir+"/"+name+".list", []byte(strings.Join(entries, "\n")+"\n"), 0644), ShouldBeNil)
+		}
+
+		// run processes the sources, returning whether any file changed
+		run := func(exclude string) bool {
+			c := NewConfig(
+				Dir(dir),
+				Ext("blacklist.conf"),
+				FileNameFmt("%v/%v.%v.%v"),
+				Logger(newLog()),
+				Prefix("address=", "server="),
+				State(dir+"/blacklist.state.json"),
+			)
+			So(c.Blacklist(&CFGstatic{Cfg: fmt.Sprintf(cfgIncremental, dir, exclude)}), ShouldBeNil)
+
+			ct, err := c.NewContent(FileObj)
+			So(err, ShouldBeNil)
+			So(c.ProcessContent(ct), ShouldBeNil)
+			return c.Changed()
+		}
+
+		// mark replaces a blacklist file's contents, so a rewrite shows
+		mark := func(f string) {
+			So(ioutil.WriteFile(f, []byte(marker), 0644), ShouldBeNil)
+		}
+
+		read := func(f string) string {
+			b, err := ioutil.ReadFile(f)
+			So(err, ShouldBeNil)
+			return string(b)
+		}
+
+		list("first", "a.com", "b.com")
+		list("second", "b.com", "c.com")
+		So(run("x.com"), ShouldBeTrue)
+		So(read(first), ShouldEqual, "address=/a.com/0.0.0.0\naddress=/b.com/0.0.0.0\n")
+		So(read(second), ShouldEqual, "address=/c.com/0.0.0.0\n")
+
+		Convey("Unchanged inputs aren't written", func() {
+			mark(first)
+			mark(second)
+			So(run("x.com"), ShouldBeFalse)
+			So(read(first), ShouldEqual, marker)
+			So(read(second), ShouldEqual, marker)
+		})
+
+		Convey("A missing file is written", func() {
+			So(os.Remove(first), ShouldBeNil)
+			mark(second)
+			So(run("x.com"), ShouldBeTrue)
+			So(read(first), ShouldEqual, "address=/a.com/0.0.0.0\naddress=/b.com/0.0.0.0\n")
+			So(read(second), ShouldEqual, marker)
+		})
+
+		Convey("A changed source is written, with the sources merged after it", func() {
+			mark(first)
+			mark(second)
+			list("second", "b.com", "d.com")
+			So(run("x.com"), ShouldBeTrue)
+			So(read(first), ShouldEqual, marker)
+			So(read(second), ShouldEqual, "address=/d.com/0.0.0.0\n")
+
+			mark(first)
+			list("first", "a.com")
+			So(run("x.com"), ShouldBeTrue)
+			So(read(first), ShouldEqual, "address=/a.com/0.0.0.0\n")
+			So(read(second), ShouldEqual, "address=/b.com/0.0.0.0\naddress=/d.com/0.0.0.0\n")
+		})
+
+		Convey("A configuration change writes every file", func() {
+			mark(first)
+			mark(second)
+			So(run("y.com"), ShouldBeTrue)
+			So(read(first), ShouldEqual, "address=/a.com/0.0.0.0\naddress=/b.com/0.0.0.0\n")
+			So(read(second), ShouldEqual, "address=/c.com/0.0.0.0\n")
+		})
+	})
+
+	Convey("Testing an unchanged second run with the allowlist and safe search", t, func() {
+		dir, err := ioutil.TempDir("/tmp", "testBlacklist")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		So(ioutil.WriteFile(dir+"/first.list", []byte("a.com\n"), 0644), ShouldBeNil)
+
+		lookup := lookupIP
+		defer func() { lookupIP = lookup }()
+		lookupIP = func(host string) ([]net.IP, error) {
+			return []net.IP{net.ParseIP("216.239.38.120")}, nil
+		}
+
+		// run removes stale files and writes the blacklist, as each blacklist run does
+		run := func() bool {
+			c := NewConfig(
+				Dir(dir),
+				Ext("blacklist.conf"),
+				FileNameFmt("%v/%v.%v.%v"),
+				Logger(newLog()),
+				Prefix("address=", "server="),
+				State(dir+"/blacklist.state.json"),
+				WCard(Wildcard{Node: "*s", Name: "*"}),
+			)
+			So(c.Blacklist(&CFGstatic{Cfg: fmt.Sprintf(cfgUnchanged, dir)}), ShouldBeNil)
+			So(c.Files().Remove(), ShouldBeNil)
+
+			ct, err := c.NewContent(FileObj)
+			So(err, ShouldBeNil)
+			So(c.ProcessContent(ct), ShouldBeNil)
+			So(c.Allowlist(), ShouldBeNil)
+			So(c.SafeSearch(), ShouldBeNil)
+			return c.Changed()
+		}
+
+		So(run(), ShouldBeTrue)
+		So(run(), ShouldBeFalse)
+		for _, f := range []string{"allowlists.allowlist.blacklist.conf", "restrictions.safe-search.blacklist.conf"} {
+			_, err = os.Stat(dir + "/" + f)
+			So(err, ShouldBeNil)
+		}
+	})
+
+	Convey("Testing writeFile() without an input sum", t, func() {
+		dir, err := ioutil.TempDir("/tmp", "testBlacklist")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		write := func(s string) bool {
+			b := &bList{file: dir + "/allowlists.allowlist.blacklist.conf", r: strings.NewReader(s), size: 1}
+			So(b.writeFile(), ShouldBeNil)
+			return b.wrote
+		}
+
+		So(write("server=/school.edu/8.8.8.8\n"), ShouldBeTrue)
+		So(write("server=/school.edu/8.8.8.8\n"), ShouldBeFalse)
+		So(write("server=/school.edu/1.1.1.1\n"), ShouldBeTrue)
+	})
+}
+
+var cfgIncremental = `blacklist {
+    dns-redirect-ip 0.0.0.0
+    exclude %[2]s
+    hosts {
+        source first {
+            file %[1]s/first.list
+            prefix ""
+        }
+        source second {
+            file %[1]s/second.list
+            prefix ""
+        }
+    }
+}
+`
+
+var cfgUnchanged = `blacklist {
+    dns-redirect-ip 0.0.0.0
+    allowlist {
+        include school.edu
+        upstream 1.1.1.1
+    }
+    safe-search {
+        disabled false
+    }
+    hosts {
+        source first {
+            file %[1]s/first.list
+            prefix ""
+        }
+    }
+}
+`
@@ -0,0 +1,268 @@
+package edgeos
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/britannic/blacklist/internal/dnsmasq"
+)
+
+// maxPending caps the queries waiting for dnsmasq's answer, so a long log of allowed queries
+// can't grow it without bound
+const maxPending = 10000
+
+// maxHits caps the domains and clients the hits file keeps, so it doesn't grow without bound;
+// the least blocked are dropped when it's saved
+const maxHits = 1000
+
+// QueryStats counts the blocked queries dnsmasq has logged by blacklist source, domain and
+// client, and records how far through the query log it has read
+type QueryStats struct {
+	Clients map[string]int `json:"clients"`
+	Domains map[string]int `json:"domains"`
+	Log     string         `json:"log"`
+	Offset  int64          `json:"offset"`
+	Since   time.Time      `json:"since"`
+	Sources map[string]int `json:"sources"`
+}
+
+// hit is a ranked QueryStats counter
+type hit struct {
+	name string
+	n    int
+}
+
+// loadHits reads the hits file, starting afresh if it doesn't exist or can't be read
+func (c *Config) loadHits() *QueryStats {
+	s := &QueryStats{}
+	if c.Hits != "" {
+		b, err := ioutil.ReadFile(c.Hits)
+		if err == nil {
+			err = json.Unmarshal(b, s)
+		}
+		if err != nil {
+			c.Debug(fmt.Sprintf("Starting a new hits file %s: %v", c.Hits, err))
+			s = &QueryStats{}
+		}
+	}
+
+	if s.Clients == nil || s.Domains == nil || s.Sources == nil {
+		*s = QueryStats{
+			Clients: make(map[string]int),
+			Domains: make(map[string]int),
+			Since:   time.Now().UTC().Truncate(time.Second),
+			Sources: make(map[string]int),
+		}
+	}
+	return s
+}
+
+// saveHits writes the hits file, keeping the maxHits most blocked domains and clients
+func (c *Config) saveHits(s *QueryStats) error {
+	if c.Hits == "" {
+		return nil
+	}
+	s.Domains, s.Clients = top(s.Domains, maxHits), top(s.Clients, maxHits)
+
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(c.Hits, append(b, '\n'), 0644)
+}
+
+// Ingest reads the dnsmasq log-queries lines added to the log file, or syslog, since the last
+// time it was read, counts the blocked queries against the blacklist source that blocked them
+// and updates the hits file; it starts from the top of the log again when it has been rotated
+func (c *Config) Ingest(log string) (*QueryStats, error) {
+	files, err := c.blacklistFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := blocked(files...)
+	if err != nil {
+		return nil, err
+	}
+
+	s := c.loadHits()
+	for _, f := range files {
+		s.Sources[c.sourceOf(f)] += 0
+	}
+
+	f, err := os.Open(log)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if s.Log != log || fi.Size() < s.Offset {
+		s.Log, s.Offset = log, 0
+	}
+	if _, err = f.Seek(s.Offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	n, err := c.ingest(s, f, b)
+	s.Offset += n
+	if err != nil {
+		return nil, err
+	}
+	return s, c.saveHits(s)
+}
+
+// ingest counts the blocked queries in r's complete lines and returns the number of bytes read
+func (c *Config) ingest(s *QueryStats, r io.Reader, b dnsmasq.Conf) (int64, error) {
+	var (
+		br      = bufio.NewReader(r)
+		n       int64
+		pending = make(map[string]string)
+	)
+
+	for {
+		line, err := br.ReadString('\n')
+		switch {
+		case err == io.EOF:
+			// a partial last line is read again once dnsmasq has finished writing it
+			return n, nil
+		case err != nil:
+			return n, err
+		}
+		n += int64(len(line))
+
+		query, name, client := logQuery(line, c.HostsDir)
+		if name == "" {
+			continue
+		}
+		name = strings.ToLower(strings.TrimSuffix(name, "."))
+
+		if query {
+			if len(pending) >= maxPending {
+				pending = make(map[string]string)
+			}
+			pending[name] = client
+			continue
+		}
+
+		if client == "" {
+			client = pending[name]
+		}
+		delete(pending, name)
+
+		h, ok := b.Match(name)
+		if !ok || h.Server && h.IP != "" {
+			continue
+		}
+		s.Sources[c.sourceOf(h.File)]++
+		s.Domains[name]++
+		if client != "" {
+			s.Clients[client]++
+		}
+	}
+}
+
+// logQuery parses a dnsmasq log-queries line, returning the name and client of a query, or the
+// name answered by a config rule or a hosts format file in hostsDir and, with log-queries=extra,
+// its client
+func logQuery(line, hostsDir string) (query bool, name, client string) {
+	i := strings.Index(line, "dnsmasq[")
+	if i < 0 {
+		return false, "", ""
+	}
+	j := strings.Index(line[i:], "]: ")
+	if j < 0 {
+		return false, "", ""
+	}
+
+	f := strings.Fields(line[i+j+3:])
+	if len(f) > 2 {
+		if _, err := strconv.Atoi(f[0]); err == nil && strings.Contains(f[1], "/") {
+			client, f = f[1][:strings.LastIndex(f[1], "/")], f[2:]
+		}
+	}
+
+	switch {
+	case len(f) == 4 && strings.HasPrefix(f[0], "query[") && f[2] == "from":
+		return true, f[1], f[3]
+	case len(f) >= 4 && f[2] == "is" && (f[0] == "config" || hostsDir != "" && strings.HasPrefix(f[0], filepath.Clean(hostsDir)+"/")):
+		return false, f[1], client
+	}
+	return false, "", ""
+}
+
+// sourceOf returns the blacklist source that wrote a file, as the area.name used by the state file
+func (c *Config) sourceOf(file string) string {
+	return strings.TrimSuffix(strings.TrimSuffix(filepath.Base(file), "."+c.Ext), "."+hostsExt)
+}
+
+// rank returns up to n of the counters in descending order, all of them if n is 0 or less
+func rank(m map[string]int, n int) []hit {
+	h := make([]hit, 0, len(m))
+	for k, v := range m {
+		h = append(h, hit{name: k, n: v})
+	}
+	sort.Slice(h, func(i, j int) bool {
+		if h[i].n != h[j].n {
+			return h[i].n > h[j].n
+		}
+		return h[i].name < h[j].name
+	})
+	if n > 0 && len(h) > n {
+		h = h[:n]
+	}
+	return h
+}
+
+// top returns the n highest of the counters
+func top(m map[string]int, n int) map[string]int {
+	if len(m) <= n {
+		return m
+	}
+	t := make(map[string]int, n)
+	for _, h := range rank(m, n) {
+		t[h.name] = h.n
+	}
+	return t
+}
+
+// Top renders every source's blocked queries, so those that never block anything stand out,
+// followed by the n most blocked domains and the n clients with the most blocked queries
+func (s *QueryStats) Top(n int) string {
+	var (
+		b strings.Builder
+		w = tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	)
+
+	fmt.Fprintf(&b, "Blocked queries since %s\n\n", s.Since.Format(time.RFC3339))
+	for _, t := range []struct {
+		hdr  string
+		hits []hit
+	}{
+		{hdr: "source", hits: rank(s.Sources, 0)},
+		{hdr: "domain", hits: rank(s.Domains, n)},
+		{hdr: "client", hits: rank(s.Clients, n)},
+	} {
+		fmt.Fprintf(w, "%s\thits\n", t.hdr)
+		for _, h := range t.hits {
+			fmt.Fprintf(w, "%s\t%d\n", h.name, h.n)
+		}
+		fmt.Fprintln(w)
+	}
+	_ = w.Flush()
+
+	return strings.TrimSuffix(b.String(), "\n")
+}
@@ -0,0 +1,168 @@
+package edgeos
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLogQuery(t *testing.T) {
+	Convey("Testing logQuery()", t, func() {
+		tests := []struct {
+			client string
+			line   string
+			name   string
+			query  bool
+		}{
+			{line: "Oct 19 10:00:00 ubnt dnsmasq[812]: query[A] ads.com from 192.168.1.10", query: true, name: "ads.com", client: "192.168.1.10"},
+			{line: "Oct 19 10:00:00 ubnt dnsmasq[812]: config ads.com is 0.0.0.0", name: "ads.com"},
+			{line: "Oct 19 10:00:00 ubnt dnsmasq[812]: config nx.com is NXDOMAIN", name: "nx.com"},
+			{line: "Oct 19 10:00:00 ubnt dnsmasq[812]: 7 192.168.1.11/53422 config ads.com is 0.0.0.0", name: "ads.com", client: "192.168.1.11"},
+			{line: "Oct 19 10:00:00 ubnt dnsmasq[812]: forwarded good.com to 8.8.8.8"},
+			{line: "Oct 19 10:00:00 ubnt dnsmasq[812]: reply good.com is 1.2.3.4"},
+			{line: "Oct 19 10:00:00 ubnt sshd[90]: config ads.com is 0.0.0.0"},
+			{line: "Oct 19 10:00:00 ubnt dnsmasq[812]: /etc/dnsmasq.hosts/hosts.yoyo.hosts track.net is 0.0.0.0", name: "track.net"},
+			{line: "Oct 19 10:00:00 ubnt dnsmasq[812]: 9 192.168.1.12/40211 /etc/dnsmasq.hosts/hosts.yoyo.hosts track.net is ::", name: "track.net", client: "192.168.1.12"},
+			{line: "Oct 19 10:00:00 ubnt dnsmasq[812]: /etc/hosts nas.home is 192.168.1.2"},
+		}
+
+		for _, tt := range tests {
+			query, name, client := logQuery(tt.line, "/etc/dnsmasq.hosts")
+			So(query, ShouldEqual, tt.query)
+			So(name, ShouldEqual, tt.name)
+			So(client, ShouldEqual, tt.client)
+		}
+	})
+}
+
+func TestIngest(t *testing.T) {
+	Convey("Testing Ingest()", t, func() {
+		dir, err := ioutil.TempDir("/tmp", "testBlacklist")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		So(ioutil.WriteFile(dir+"/domains.malc0de.blacklist.conf", []byte("address=/ads.com/0.0.0.0\n"), 0644), ShouldBeNil)
+		So(ioutil.WriteFile(dir+"/hosts.yoyo.blacklist.conf", []byte("address=/track.net/0.0.0.0\n"), 0644), ShouldBeNil)
+		So(ioutil.WriteFile(dir+"/hosts.unused.blacklist.conf", []byte("address=/never.org/0.0.0.0\n"), 0644), ShouldBeNil)
+
+		c := NewConfig(
+			Dir(dir),
+			Ext("blacklist.conf"),
+			FileNameFmt("%v/%v.%v.%v"),
+			Hits(dir+"/blacklist.hits.json"),
+			Logger(newLog()),
+		)
+
+		log := dir + "/messages"
+		So(ioutil.WriteFile(log, []byte(queryLog), 0644), ShouldBeNil)
+
+		s, err := c.Ingest(log)
+		So(err, ShouldBeNil)
+		So(s.Sources, ShouldResemble, map[string]int{"domains.malc0de": 2, "hosts.yoyo": 1, "hosts.unused": 0})
+		So(s.Domains, ShouldResemble, map[string]int{"ads.com": 1, "x.ads.com": 1, "track.net": 1})
+		So(s.Clients, ShouldResemble, map[string]int{"192.168.1.10": 2, "192.168.1.11": 1})
+		So(s.Offset, ShouldEqual, len(queryLog)-len("Oct 19 10:00:09 ubnt dnsmasq[812]: config ads.com is 0.0"))
+
+		Convey("Only the lines added since are read on the next run", func() {
+			f, err := os.OpenFile(log, os.O_APPEND|os.O_WRONLY, 0644)
+			So(err, ShouldBeNil)
+			_, err = f.WriteString(".0.0\n")
+			So(err, ShouldBeNil)
+			So(f.Close(), ShouldBeNil)
+
+			s, err = c.Ingest(log)
+			So(err, ShouldBeNil)
+			So(s.Sources["domains.malc0de"], ShouldEqual, 3)
+			So(s.Offset, ShouldEqual, len(queryLog)+len(".0.0\n"))
+		})
+
+		Convey("A rotated log is read from the top", func() {
+			So(ioutil.WriteFile(log, []byte("Oct 20 00:00:01 ubnt dnsmasq[812]: config track.net is 0.0.0.0\n"), 0644), ShouldBeNil)
+			s, err = c.Ingest(log)
+			So(err, ShouldBeNil)
+			So(s.Sources["hosts.yoyo"], ShouldEqual, 2)
+		})
+
+		Convey("Answers from hosts format files are counted", func() {
+			So(os.Mkdir(dir+"/hosts", 0755), ShouldBeNil)
+			So(ioutil.WriteFile(dir+"/hosts/hosts.fmt.hosts", []byte("0.0.0.0 tracker.io\n"), 0644), ShouldBeNil)
+			So(ioutil.WriteFile(log, []byte("Oct 20 00:00:01 ubnt dnsmasq[812]: query[A] tracker.io from 192.168.1.12\n"+
+				"Oct 20 00:00:01 ubnt dnsmasq[812]: "+dir+"/hosts/hosts.fmt.hosts tracker.io is 0.0.0.0\n"), 0644), ShouldBeNil)
+
+			c := NewConfig(
+				Dir(dir),
+				Ext("blacklist.conf"),
+				FileNameFmt("%v/%v.%v.%v"),
+				Hits(dir+"/blacklist.hits.json"),
+				HostsDir(dir+"/hosts"),
+				Logger(newLog()),
+			)
+			s, err = c.Ingest(log)
+			So(err, ShouldBeNil)
+			So(s.Sources["hosts.fmt"], ShouldEqual, 1)
+			So(s.Domains["tracker.io"], ShouldEqual, 1)
+			So(s.Clients["192.168.1.12"], ShouldEqual, 1)
+		})
+
+		Convey("The hits file keeps the most blocked domains and clients", func() {
+			for i := 0; i < maxHits+5; i++ {
+				s.Domains[fmt.Sprintf("d%04d.com", i)] = 1
+				s.Clients[fmt.Sprintf("10.0.%d.%d", i/256, i%256)] = 1
+			}
+			So(c.saveHits(s), ShouldBeNil)
+
+			s = c.loadHits()
+			So(len(s.Domains), ShouldEqual, maxHits)
+			So(len(s.Clients), ShouldEqual, maxHits)
+			So(s.Domains["ads.com"], ShouldEqual, 1)
+			So(s.Clients["192.168.1.10"], ShouldEqual, 2)
+			So(s.Sources["domains.malc0de"], ShouldEqual, 2)
+		})
+
+		Convey("A missing log is an error", func() {
+			_, err = c.Ingest(dir + "/missing")
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestTop(t *testing.T) {
+	Convey("Testing Top()", t, func() {
+		s := &QueryStats{
+			Clients: map[string]int{"192.168.1.10": 2, "192.168.1.11": 1},
+			Domains: map[string]int{"ads.com": 1, "x.ads.com": 3, "track.net": 2},
+			Since:   time.Date(2020, 7, 1, 0, 0, 0, 0, time.UTC),
+			Sources: map[string]int{"domains.malc0de": 4, "hosts.yoyo": 2, "hosts.unused": 0},
+		}
+		So(s.Top(2), ShouldEqual, `Blocked queries since 2020-07-01T00:00:00Z
+
+source           hits
+domains.malc0de  4
+hosts.yoyo       2
+hosts.unused     0
+
+domain     hits
+x.ads.com  3
+track.net  2
+
+client        hits
+192.168.1.10  2
+192.168.1.11  1
+`)
+	})
+}
+
+var queryLog = `Oct 19 10:00:00 ubnt dnsmasq[812]: query[A] ads.com from 192.168.1.10
+Oct 19 10:00:00 ubnt dnsmasq[812]: config ads.com is 0.0.0.0
+Oct 19 10:00:01 ubnt dnsmasq[812]: query[A] good.com from 192.168.1.10
+Oct 19 10:00:01 ubnt dnsmasq[812]: forwarded good.com to 8.8.8.8
+Oct 19 10:00:01 ubnt dnsmasq[812]: reply good.com is 1.2.3.4
+Oct 19 10:00:02 ubnt dnsmasq[812]: 9 192.168.1.11/40112 query[AAAA] x.ads.com from 192.168.1.11
+Oct 19 10:00:02 ubnt dnsmasq[812]: 9 192.168.1.11/40112 config x.ads.com is ::
+Oct 19 10:00:03 ubnt dnsmasq[812]: query[A] Track.Net from 192.168.1.10
+Oct 19 10:00:03 ubnt dnsmasq[812]: config Track.Net is 0.0.0.0
+Oct 19 10:00:09 ubnt dnsmasq[812]: config ads.com is 0.0`
@@ -47,6 +47,13 @@ func download(s *source) *source {
 	}
 
 	s.r, s.err = bytes.NewBuffer(body), err
+	if s.err == nil && s.signed() {
+		if s.r, s.err = s.verified(s.r); s.err != nil {
+			s.Log.Warning(s.err.Error())
+			s.r = bytes.NewReader([]byte{})
+		}
+	}
+
 	if err = resp.Body.Close(); err != nil {
 		s.Log.Warning(err.Error)
 	}
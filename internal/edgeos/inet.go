@@ -1,19 +1,132 @@
 package edgeos
 
 import (
+	"context"
 	"fmt"
 	"net"
+	"net/http"
+	"net/url"
+	"strings"
 	"time"
 )
 
-// ChkWeb returns true if DNS is working
-func ChkWeb(site string, port int) bool {
-	target := fmt.Sprintf("%s:%d", site, port)
-	timeOut := 3 * time.Second
-	conn, err := net.DialTimeout("tcp4", target, timeOut)
+// connectivity policy node and leaves
+const (
+	connectivity = "connectivity"
+	family       = "family"
+	method       = "method"
+	probe        = "probe"
+)
+
+// connectivity check methods
+const (
+	head   = "head"
+	tcpChk = "tcp"
+)
+
+// families maps each connectivity family to the network probes are made over
+var families = map[string]string{"any": "tcp", "ipv4": "tcp4", "ipv6": "tcp6"}
+
+// defProbe is probed if the connectivity policy doesn't list any probe targets
+const defProbe = "www.google.com:443"
+
+// Connected checks connectivity using the blacklist's connectivity policy and returns an error if
+// none of its probe targets answer; the url sources then aren't downloaded and keep their previous
+// blacklist files. It doesn't check if the policy is disabled or no url sources are enabled.
+func (c *Config) Connected() error {
+	p := c.tree[connectivity]
+	if c.Disabled || p != nil && p.disabled || len(c.GetAll(urls).src) == 0 {
+		return nil
+	}
+
+	var (
+		errs    []string
+		chk     = tcpChk
+		network = families["any"]
+		probes  = []string{defProbe}
+	)
+	if p != nil {
+		if p.method != "" {
+			chk = p.method
+		}
+		if n, ok := families[p.family]; ok {
+			network = n
+		}
+		if len(p.probe) > 0 {
+			probes = p.probe
+		}
+	}
+
+	for _, t := range probes {
+		var err error
+		switch chk {
+		case head:
+			err = headProbe(network, t, c.Timeout)
+		default:
+			err = dial(network, t)
+		}
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, err.Error())
+	}
+
+	c.offline = true
+	return fmt.Errorf("no internet access: %s", strings.Join(errs, "; "))
+}
+
+// dial opens and closes a connection to a probe target, a host:port or url, over network
+func dial(network, target string) error {
+	if u, err := url.Parse(target); err == nil && u.Host != "" {
+		port := u.Port()
+		switch {
+		case port != "":
+		case u.Scheme == "http":
+			port = "80"
+		default:
+			port = "443"
+		}
+		target = net.JoinHostPort(u.Hostname(), port)
+	}
+
+	conn, err := net.DialTimeout(network, target, 3*time.Second)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// headProbe makes a HEAD request to a probe target, a url or a host:port reached with https, over
+// network; any response shows there's connectivity
+func headProbe(network, target string, timeout time.Duration) error {
+	if !strings.Contains(target, "://") {
+		target = "https://" + target + "/"
+	}
+
+	if timeout <= 0 {
+		timeout = 3 * time.Second
+	}
+
+	d := &net.Dialer{Timeout: timeout}
+	client := &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, addr string) (net.Conn, error) {
+				return d.DialContext(ctx, network, addr)
+			},
+			Proxy: http.ProxyFromEnvironment,
+		},
+	}
+
+	req, err := http.NewRequest(http.MethodHead, target, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", agent)
+
+	resp, err := client.Do(req)
 	if err != nil {
-		return false
+		return err
 	}
-	conn.Close()
-	return true
+	return resp.Body.Close()
 }
@@ -1,29 +1,95 @@
 package edgeos
 
 import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	. "github.com/smartystreets/goconvey/convey"
 )
 
-func TestChkWeb(t *testing.T) {
-	Convey("Testing TestChkWeb()", t, func() {
+func TestConnected(t *testing.T) {
+	Convey("Testing Connected()", t, func() {
+		l, err := net.Listen("tcp4", "127.0.0.1:0")
+		So(err, ShouldBeNil)
+		defer l.Close()
+		go func() {
+			for {
+				conn, err := l.Accept()
+				if err != nil {
+					return
+				}
+				conn.Close()
+			}
+		}()
+
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+		}))
+		defer srv.Close()
+
+		// closed is an address nothing listens on
+		c, err := net.Listen("tcp4", "127.0.0.1:0")
+		So(err, ShouldBeNil)
+		closed := c.Addr().String()
+		c.Close()
+
 		tests := []struct {
-			exp  bool
-			port int
-			site string
+			name    string
+			policy  string
+			sources string
+			err     bool
 		}{
-			{exp: true, site: "www.google.com", port: 443},
-			{exp: true, site: "yahoo.com", port: 80},
-			{exp: true, site: "bing.com", port: 443},
-			{exp: false, site: "bigtop.@@@", port: 80},
+			{name: "a tcp probe", policy: "family ipv4\nprobe " + closed + "\nprobe " + l.Addr().String()},
+			{name: "a url tcp probe", policy: "probe http://" + l.Addr().String() + "/"},
+			{name: "a HEAD probe", policy: "method head\nprobe " + srv.URL},
+			{name: "failed probes", policy: "probe " + closed, err: true},
+			{name: "a failed HEAD probe", policy: "method head\nprobe " + closed, err: true},
+			{name: "failed ipv6 probes", policy: "family ipv6\nprobe " + l.Addr().String(), err: true},
+			{name: "a disabled policy", policy: "disabled true\nprobe " + closed},
+			{name: "no url sources", policy: "probe " + closed, sources: "file /dev/null"},
 		}
+
 		for _, tt := range tests {
-			Convey("Current test: "+tt.site, func() {
-				got := ChkWeb(tt.site, tt.port)
-				So(tt.exp, ShouldEqual, got)
+			Convey("with "+tt.name, func() {
+				if tt.sources == "" {
+					tt.sources = "url http://example.org/hosts"
+				}
+				c := NewConfig(Logger(newLog()))
+				So(c.Blacklist(&CFGstatic{Cfg: fmt.Sprintf(cfgConnectivity, tt.policy, tt.sources)}), ShouldBeNil)
+
+				err := c.Connected()
+				So(err != nil, ShouldEqual, tt.err)
+
+				ct, err := c.NewContent(URLhObj)
+				So(err, ShouldBeNil)
+				So(ct.Len() == 0, ShouldEqual, tt.err || tt.sources != "url http://example.org/hosts")
+
+				d := NewConfig()
+				So(d.Blacklist(&CFGstatic{Cfg: c.Boot()}), ShouldBeNil)
+				So(d.Boot(), ShouldEqual, c.Boot())
 			})
 		}
+
+		Convey("with the default probe", func() {
+			c := NewConfig(Logger(newLog()))
+			So(c.Blacklist(&CFGstatic{Cfg: "blacklist {\n    hosts {\n        source ads {\n            url http://example.org/hosts\n        }\n    }\n}\n"}), ShouldBeNil)
+			So(c.tree[connectivity], ShouldBeNil)
+			So(c.Boot(), ShouldNotContainSubstring, connectivity)
+		})
 	})
+}
 
+var cfgConnectivity = `blacklist {
+    connectivity {
+        %s
+    }
+    hosts {
+        source ads {
+            %s
+        }
+    }
 }
+`
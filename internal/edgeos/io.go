@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
 	"os"
 	"strings"
@@ -129,7 +130,8 @@ func (c *CFGstatic) read() io.Reader {
 	return strings.NewReader(c.Cfg)
 }
 
-// writeFile saves domains/hosts/roots data to disk
+// writeFile saves domains/hosts/roots data to disk, unless the file already exists and its inputs
+// haven't changed, or, for files without an input sum, its contents haven't
 func (b *bList) writeFile() error {
 	var (
 		err error
@@ -140,6 +142,21 @@ func (b *bList) writeFile() error {
 		return nil
 	}
 
+	switch _, serr := os.Stat(b.file); {
+	case serr == nil && b.sum != "" && b.sum == b.prev:
+		return nil
+	case serr == nil && b.sum == "":
+		// files without an input sum are small, so compare their contents instead
+		var d, prev []byte
+		if d, err = ioutil.ReadAll(b.r); err != nil {
+			return err
+		}
+		if prev, err = ioutil.ReadFile(b.file); err == nil && bytes.Equal(prev, d) {
+			return nil
+		}
+		b.r = bytes.NewReader(d)
+	}
+
 	if w, err = os.Create(b.file); err != nil {
 		return err
 	}
@@ -152,5 +169,6 @@ func (b *bList) writeFile() error {
 		return err
 	}
 
+	b.wrote = true
 	return err
 }
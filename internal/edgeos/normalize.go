@@ -0,0 +1,74 @@
+package edgeos
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strings"
+
+	"golang.org/x/net/idna"
+	"golang.org/x/net/publicsuffix"
+)
+
+var (
+	// idnaProfile is IDNA2008 lookup processing, which also checks the RFC 1035 label and
+	// name lengths; it tolerates underscores since they're common in blocklists
+	idnaProfile = idna.New(
+		idna.MapForLookup(),
+		idna.BidiRule(),
+		idna.Transitional(false),
+		idna.StrictDomainName(false),
+		idna.VerifyDNSLength(true),
+	)
+
+	// reserved are the special-use names of RFC 2606 and RFC 6761, plus the local and
+	// localdomain names hosts files conventionally use
+	reserved = func() *trie {
+		t := newTrie()
+		for _, k := range []string{
+			"example",
+			"example.com",
+			"example.net",
+			"example.org",
+			"invalid",
+			"local",
+			"localdomain",
+			"localhost",
+			"test",
+		} {
+			t.set([]byte(k))
+		}
+		return t
+	}()
+)
+
+// normalize returns fqdn as a lower case, punycode encoded domain name without a trailing
+// dot, or an error if it isn't a valid, blockable domain name
+func normalize(fqdn []byte) ([]byte, error) {
+	a, err := idnaProfile.ToASCII(string(bytes.TrimSuffix(fqdn, []byte("."))))
+	switch {
+	case err != nil:
+		return nil, err
+	case net.ParseIP(a) != nil || numeric(a[strings.LastIndexByte(a, '.')+1:]):
+		return nil, fmt.Errorf("%s is an IP address", a)
+	case reserved.subKeyExists([]byte(a)):
+		return nil, fmt.Errorf("%s is a reserved name", a)
+	}
+
+	// unlisted TLDs are their own public suffix, but aren't from the ICANN section; this
+	// lets private suffixes such as blogspot.com through, which sources do block
+	if s, icann := publicsuffix.PublicSuffix(a); s == a && (icann || !strings.Contains(a, ".")) {
+		return nil, fmt.Errorf("%s is a public suffix", a)
+	}
+	return []byte(a), nil
+}
+
+// numeric returns true if label is all digits, which no TLD is
+func numeric(label string) bool {
+	for _, r := range label {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
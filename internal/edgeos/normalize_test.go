@@ -0,0 +1,98 @@
+package edgeos
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestNormalize(t *testing.T) {
+	Convey("Testing normalize()", t, func() {
+		tests := []struct {
+			fqdn string
+			exp  string
+			err  string
+		}{
+			{fqdn: "ads.tracker.com", exp: "ads.tracker.com"},
+			{fqdn: "ADS.Tracker.com.", exp: "ads.tracker.com"},
+			{fqdn: "bücher.de", exp: "xn--bcher-kva.de"},
+			{fqdn: "ad_server.tracker.com", exp: "ad_server.tracker.com"},
+			{fqdn: "tracker.blogspot.com", exp: "tracker.blogspot.com"},
+			{fqdn: "blogspot.com", exp: "blogspot.com"},
+			{fqdn: "com", err: "com is a public suffix"},
+			{fqdn: "co.uk", err: "co.uk is a public suffix"},
+			{fqdn: "lan", err: "lan is a public suffix"},
+			{fqdn: "localhost", err: "localhost is a reserved name"},
+			{fqdn: "localhost.localdomain", err: "localhost.localdomain is a reserved name"},
+			{fqdn: "ads.example.com", err: "ads.example.com is a reserved name"},
+			{fqdn: "ads.test", err: "ads.test is a reserved name"},
+			{fqdn: "10.0.0.1", err: "10.0.0.1 is an IP address"},
+			{fqdn: "ads.123", err: "ads.123 is an IP address"},
+			{fqdn: strings.Repeat("a", 64) + ".com", err: "idna: invalid label"},
+			{fqdn: strings.Repeat("a.", 126) + "com", err: "idna: invalid label"},
+			{fqdn: "ads..com", err: "idna: invalid label"},
+		}
+
+		for _, tt := range tests {
+			act, err := normalize([]byte(tt.fqdn))
+			if tt.err != "" {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, tt.err)
+				So(act, ShouldBeNil)
+				continue
+			}
+			So(err, ShouldBeNil)
+			So(string(act), ShouldEqual, tt.exp)
+		}
+	})
+}
+
+func TestInvalidStats(t *testing.T) {
+	Convey("Testing invalid entries in ProcessContent()", t, func() {
+		dir, err := ioutil.TempDir("/tmp", "testBlacklist")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		So(ioutil.WriteFile(dir+"/hosts.list", []byte(
+			"ads.tracker.com\nlocalhost.localdomain\nbücher.de\nco.uk\nads.example.com\n",
+		), 0644), ShouldBeNil)
+
+		c := NewConfig(
+			Dir(dir),
+			Ext("blacklist.conf"),
+			FileNameFmt("%v/%v.%v.%v"),
+			Logger(newLog()),
+			Prefix("address=", "server="),
+		)
+		So(c.Blacklist(&CFGstatic{Cfg: fmt.Sprintf(cfgInvalidEntries, dir)}), ShouldBeNil)
+
+		ct, err := c.NewContent(FileObj)
+		So(err, ShouldBeNil)
+		So(c.ProcessContent(ct), ShouldBeNil)
+
+		act, err := ioutil.ReadFile(dir + "/hosts.mixed.blacklist.conf")
+		So(err, ShouldBeNil)
+		So(string(act), ShouldEqual, "address=/ads.tracker.com/0.0.0.0\naddress=/xn--bcher-kva.de/0.0.0.0\n")
+
+		dropped, extracted, invalid, kept := c.GetTotalStats()
+		So(dropped, ShouldEqual, 0)
+		So(extracted, ShouldEqual, 5)
+		So(invalid, ShouldEqual, 3)
+		So(kept, ShouldEqual, 2)
+	})
+}
+
+var cfgInvalidEntries = `blacklist {
+    dns-redirect-ip 0.0.0.0
+    hosts {
+        source mixed {
+            file %[1]s/hosts.list
+            prefix ""
+        }
+    }
+}
+`
@@ -23,6 +23,10 @@ func (o *Objects) Files() *CFile {
 	var c = CFile{Env: o.Env}
 	if !o.Disabled {
 		for _, obj := range o.src {
+			if o.hostsFile(obj.nType) {
+				c.Names = append(c.Names, obj.setFilePrefix(o.Env.HostsDir+"/%v.%v."+hostsExt))
+				continue
+			}
 			c.Names = append(c.Names, obj.setFilePrefix(o.Env.Dir+"/%v.%v."+o.Env.Ext))
 		}
 		sort.Strings(c.Names)
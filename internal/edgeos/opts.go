@@ -13,24 +13,36 @@ import (
 // Env is struct of parameters
 type Env struct {
 	ctr
+	bundle  map[string][]byte // url sources' bodies from an imported bundle
+	changed int32
+	confs   []string // changed blacklist configuration files, which dnsmasq only re-reads on a restart
+	offline bool     // url sources aren't downloaded, so they keep their previous blacklist files
 	// ioWriter io.Writer
 	Log      *logging.Logger
 	API      string        `json:"API,omitempty"`
 	Arch     string        `json:"Arch,omitempty"`
 	Bash     string        `json:"Bash,omitempty"`
+	Catalog  string        `json:"Catalog file,omitempty"`
 	Cores    int           `json:"Cores,omitempty"`
 	Disabled bool          `json:"Disabled"`
 	Dbug     bool          `json:"Dbug,omitempty"`
-	Dex      *list         `json:"Dex,omitempty"`
+	Dex      *trie         `json:"Dex,omitempty"`
 	Dir      string        `json:"Dir,omitempty"`
 	DNSsvc   string        `json:"dnsmasq service,omitempty"`
-	Exc      *list         `json:"Exc,omitempty"`
+	Exc      *trie         `json:"Exc,omitempty"`
 	Ext      string        `json:"dnsmasq fileExt.,omitempty"`
 	File     string        `json:"File,omitempty"`
 	FnFmt    string        `json:"File name fmt,omitempty"`
+	Hits     string        `json:"Hits file,omitempty"`
+	HostsDir string        `json:"Hosts dir,omitempty"`
 	InCLI    string        `json:"-"`
 	Method   string        `json:"HTTP method,omitempty"`
+	Overlap  bool          `json:"Overlap,omitempty"`
 	Pfx      dnsPfx        `json:"Prefix,omitempty"`
+	PIDfile  string        `json:"PID file,omitempty"`
+	Reload   string        `json:"Reload,omitempty"`
+	Shell    string        `json:"CLI shell,omitempty"`
+	State    string        `json:"State file,omitempty"`
 	Test     bool          `json:"Test,omitempty"`
 	Timeout  time.Duration `json:"Timeout,omitempty"`
 	Verb     bool          `json:"Verbosity,omitempty"`
@@ -102,6 +114,15 @@ func Bash(s string) Option {
 	}
 }
 
+// Catalog sets the local file that updates the built in catalog of curated sources
+func Catalog(s string) Option {
+	return func(c *Config) Option {
+		previous := c.Catalog
+		c.Catalog = s
+		return Catalog(previous)
+	}
+}
+
 // Cores sets max CPU cores
 func Cores(i int) Option {
 	return func(c *Config) Option {
@@ -175,6 +196,25 @@ func FileNameFmt(s string) Option {
 	}
 }
 
+// Hits sets the file that records the blocked query counts ingested from the dnsmasq log
+func Hits(s string) Option {
+	return func(c *Config) Option {
+		previous := c.Hits
+		c.Hits = s
+		return Hits(previous)
+	}
+}
+
+// HostsDir sets the directory the blacklist hosts format files are written to, when the reload
+// strategy needs them
+func HostsDir(s string) Option {
+	return func(c *Config) Option {
+		previous := c.HostsDir
+		c.HostsDir = s
+		return HostsDir(previous)
+	}
+}
+
 // InCLI sets the CLI inSession command
 func InCLI(s string) Option {
 	return func(c *Config) Option {
@@ -209,8 +249,8 @@ func NewConfig(opts ...Option) *Config {
 		Env: &Env{
 			ctr: ctr{RWMutex: &sync.RWMutex{}, stat: make(stat)},
 			// ctr: ctr{stat: make(stat)},
-			Dex: &list{RWMutex: &sync.RWMutex{}, entry: make(entry)},
-			Exc: &list{RWMutex: &sync.RWMutex{}, entry: make(entry)},
+			Dex: newTrie(),
+			Exc: newTrie(),
 		},
 	}
 	for _, opt := range opts {
@@ -219,6 +259,15 @@ func NewConfig(opts ...Option) *Config {
 	return &c
 }
 
+// Overlap toggles recording of source entries for the overlap report
+func Overlap(b bool) Option {
+	return func(c *Config) Option {
+		previous := c.Overlap
+		c.Overlap = b
+		return Overlap(previous)
+	}
+}
+
 // Prefix sets the dnsmasq configuration address line prefix
 func Prefix(d string, h string) Option {
 	return func(c *Config) Option {
@@ -236,6 +285,42 @@ func (e *Env) String() string {
 	return string(out)
 }
 
+// PIDfile sets the dnsmasq PID file, which the sighup reload strategy reads
+func PIDfile(s string) Option {
+	return func(c *Config) Option {
+		previous := c.PIDfile
+		c.PIDfile = s
+		return PIDfile(previous)
+	}
+}
+
+// Reload sets how ReloadDNS reloads dnsmasq: restart, sighup or reload
+func Reload(s string) Option {
+	return func(c *Config) Option {
+		previous := c.Reload
+		c.Reload = s
+		return Reload(previous)
+	}
+}
+
+// Shell sets the EdgeOS CLI shell used to commit configuration changes
+func Shell(s string) Option {
+	return func(c *Config) Option {
+		previous := c.Shell
+		c.Shell = s
+		return Shell(previous)
+	}
+}
+
+// State sets the file that records source entry counts between runs
+func State(s string) Option {
+	return func(c *Config) Option {
+		previous := c.State
+		c.State = s
+		return State(previous)
+	}
+}
+
 // Test toggles testing mode on or off
 func Test(b bool) Option {
 	return func(c *Config) Option {
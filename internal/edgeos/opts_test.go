@@ -117,10 +117,10 @@ func TestOption(t *testing.T) {
 			Cores:    2,
 			Disabled: false,
 			Dbug:     true,
-			Dex:      &list{entry: entry{}},
+			Dex:      &trie{root: &tnode{}},
 			Dir:      "/tmp",
 			DNSsvc:   "service dnsmasq restart",
-			Exc:      &list{entry: entry{}},
+			Exc:      &trie{root: &tnode{}},
 			Ext:      "blacklist.conf",
 			File:     "/config/config.boot",
 			FnFmt:    "%v/%v.%v.%v",
@@ -0,0 +1,97 @@
+package edgeos
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// SourceOverlap holds how many of a source's entries are unique to it and how many it
+// shares with each of the other sources in an Overlaps report
+type SourceOverlap struct {
+	Name     string
+	Priority int
+	Shared   []int
+	Total    int
+	Unique   int
+}
+
+// Overlaps is an overlap matrix of the url and file sources processed with Overlap(true)
+type Overlaps []*SourceOverlap
+
+// Overlaps returns the overlap matrix for the url and file sources, in priority order
+func (c *Config) Overlaps() Overlaps {
+	var srcs []*source
+	for _, n := range []string{domains, hosts} {
+		if !c.nodeExists(n) {
+			continue
+		}
+		for _, s := range c.tree[n].src {
+			if s.seen != nil {
+				srcs = append(srcs, s)
+			}
+		}
+	}
+	sortSources(srcs)
+
+	o := make(Overlaps, len(srcs))
+	for i, s := range srcs {
+		o[i] = &SourceOverlap{
+			Name:     s.area() + "." + s.name,
+			Priority: s.priority,
+			Shared:   make([]int, len(srcs)),
+			Total:    len(s.seen),
+		}
+
+		for k := range s.seen {
+			shared := false
+			for j, t := range srcs {
+				if j == i {
+					continue
+				}
+				if _, ok := t.seen[k]; ok {
+					o[i].Shared[j]++
+					shared = true
+				}
+			}
+			if !shared {
+				o[i].Unique++
+			}
+		}
+	}
+	return o
+}
+
+// String renders the overlap matrix; column n counts the entries shared with source n
+func (o Overlaps) String() string {
+	if len(o) == 0 {
+		return "No url or file sources were processed\n"
+	}
+
+	var (
+		b strings.Builder
+		w = tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	)
+
+	row := []string{"#", "source", "priority", "total", "unique"}
+	for i := range o {
+		row = append(row, strconv.Itoa(i+1))
+	}
+	fmt.Fprintln(w, strings.Join(row, "\t"))
+
+	for i, s := range o {
+		row = []string{strconv.Itoa(i + 1), s.Name, strconv.Itoa(s.Priority), strconv.Itoa(s.Total), strconv.Itoa(s.Unique)}
+		for j, n := range s.Shared {
+			if i == j {
+				row = append(row, "-")
+				continue
+			}
+			row = append(row, strconv.Itoa(n))
+		}
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+
+	_ = w.Flush()
+	return b.String()
+}
@@ -0,0 +1,142 @@
+package edgeos
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestOverlaps(t *testing.T) {
+	Convey("Testing Overlaps()", t, func() {
+		dir, err := ioutil.TempDir("/tmp", "testBlacklist")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		for f, data := range map[string]string{
+			"a.list": "ads.com\nshared.com\ntrack.com\n",
+			"b.list": "shared.com\ntrack.com\n",
+			"c.list": "shared.com\nonly-c.com\n",
+		} {
+			So(ioutil.WriteFile(dir+"/"+f, []byte(data), 0644), ShouldBeNil)
+		}
+
+		c := NewConfig(
+			Dir(dir),
+			Ext("blacklist.conf"),
+			FileNameFmt("%v/%v.%v.%v"),
+			Logger(newLog()),
+			Overlap(true),
+			Prefix("address=", "server="),
+		)
+		So(c.Blacklist(&CFGstatic{Cfg: fmt.Sprintf(cfgOverlap, dir)}), ShouldBeNil)
+
+		ct, err := c.NewContent(FileObj)
+		So(err, ShouldBeNil)
+		So(c.ProcessContent(ct), ShouldBeNil)
+
+		Convey("The highest priority source keeps shared entries", func() {
+			for f, exp := range map[string]string{
+				"hosts.zeta.blacklist.conf": "address=/ads.com/0.0.0.0\naddress=/shared.com/0.0.0.0\naddress=/track.com/0.0.0.0\n",
+				"hosts.beta.blacklist.conf": "address=/only-c.com/0.0.0.0\n",
+			} {
+				act, err := ioutil.ReadFile(dir + "/" + f)
+				So(err, ShouldBeNil)
+				So(string(act), ShouldEqual, exp)
+			}
+
+			_, err := os.Stat(dir + "/hosts.alpha.blacklist.conf")
+			So(os.IsNotExist(err), ShouldBeTrue)
+		})
+
+		Convey("The overlap matrix counts unique and shared entries", func() {
+			o := c.Overlaps()
+			So(len(o), ShouldEqual, 3)
+			So(o[0], ShouldResemble, &SourceOverlap{Name: "hosts.zeta", Priority: 1, Shared: []int{0, 2, 1}, Total: 3, Unique: 1})
+			So(o[1], ShouldResemble, &SourceOverlap{Name: "hosts.alpha", Priority: 5, Shared: []int{2, 0, 1}, Total: 2, Unique: 0})
+			So(o[2], ShouldResemble, &SourceOverlap{Name: "hosts.beta", Priority: 5, Shared: []int{1, 1, 0}, Total: 2, Unique: 1})
+			So(o.String(), ShouldEqual, expOverlap)
+		})
+	})
+
+	Convey("Testing Overlaps() between domains sources", t, func() {
+		dir, err := ioutil.TempDir("/tmp", "testBlacklist")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		So(ioutil.WriteFile(dir+"/a.list", []byte("ads.com\nshared.com\n"), 0644), ShouldBeNil)
+		So(ioutil.WriteFile(dir+"/b.list", []byte("shared.com\nonly-b.com\n"), 0644), ShouldBeNil)
+
+		c := NewConfig(
+			Dir(dir),
+			Ext("blacklist.conf"),
+			FileNameFmt("%v/%v.%v.%v"),
+			Logger(newLog()),
+			Overlap(true),
+			Prefix("address=", "server="),
+		)
+		So(c.Blacklist(&CFGstatic{Cfg: fmt.Sprintf(cfgOverlapDomains, dir)}), ShouldBeNil)
+
+		ct, err := c.NewContent(FileObj)
+		So(err, ShouldBeNil)
+		So(c.ProcessContent(ct), ShouldBeNil)
+
+		o := c.Overlaps()
+		So(len(o), ShouldEqual, 2)
+		So(o[0], ShouldResemble, &SourceOverlap{Name: "domains.a", Priority: 1, Shared: []int{0, 1}, Total: 2, Unique: 1})
+		So(o[1], ShouldResemble, &SourceOverlap{Name: "domains.b", Priority: 2, Shared: []int{1, 0}, Total: 2, Unique: 1})
+	})
+
+	Convey("Testing Overlaps() without processed sources", t, func() {
+		So(NewConfig().Overlaps().String(), ShouldEqual, "No url or file sources were processed\n")
+	})
+}
+
+var (
+	cfgOverlap = `blacklist {
+    dns-redirect-ip 0.0.0.0
+    hosts {
+        source alpha {
+            file %[1]s/b.list
+            prefix ""
+            priority 5
+        }
+        source beta {
+            file %[1]s/c.list
+            prefix ""
+            priority 5
+        }
+        source zeta {
+            file %[1]s/a.list
+            prefix ""
+            priority 1
+        }
+    }
+}
+`
+
+	cfgOverlapDomains = `blacklist {
+    dns-redirect-ip 0.0.0.0
+    domains {
+        source a {
+            file %[1]s/a.list
+            prefix ""
+            priority 1
+        }
+        source b {
+            file %[1]s/b.list
+            prefix ""
+            priority 2
+        }
+    }
+}
+`
+
+	expOverlap = `#  source       priority  total  unique  1  2  3
+1  hosts.zeta   1         3      1       -  2  1
+2  hosts.alpha  5         2      0       2  -  1
+3  hosts.beta   5         2      1       1  1  -
+`
+)
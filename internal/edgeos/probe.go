@@ -0,0 +1,107 @@
+package edgeos
+
+import (
+	"fmt"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/britannic/blacklist/internal/dnsmasq"
+)
+
+// Querier looks up a name's A or AAAA records on a particular DNS server
+type Querier interface {
+	Lookup(name string) (*dnsmasq.Answer, error)
+	Lookup6(name string) (*dnsmasq.Answer, error)
+}
+
+// FileProbe holds how many of a blacklist file's entries were sampled and those that weren't
+// blocked, with what the DNS server answered for them
+type FileProbe struct {
+	File    string
+	Sampled int
+	Missed  []string
+}
+
+// Probes is a report of the blacklist files probed
+type Probes []*FileProbe
+
+// Probe samples up to n address= entries from each of the blacklist files and queries them on
+// the DNS server; entries that resolve to anything but their configured IP, and aren't NXDOMAIN,
+// aren't blocked, which usually means dnsmasq hasn't loaded the file. Entries redirected to an
+// IPv6 address are queried for AAAA records, since dnsmasq has no A records for them.
+func (c *Config) Probe(q Querier, n int) (Probes, error) {
+	files, err := c.blacklistFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	var p Probes
+	for _, f := range files {
+		conf, err := blocked(f)
+		if err != nil {
+			return nil, err
+		}
+
+		fp := &FileProbe{File: filepath.Base(f)}
+		for _, k := range conf.Sample(n) {
+			fp.Sampled++
+			lookup := q.Lookup
+			if ip := net.ParseIP(conf[k].IP); ip != nil && ip.To4() == nil {
+				lookup = q.Lookup6
+			}
+			a, err := lookup(k)
+			switch {
+			case err != nil:
+				fp.Missed = append(fp.Missed, err.Error())
+			case !a.Redirected(conf[k].IP):
+				fp.Missed = append(fp.Missed, fmt.Sprintf("%s: %s", k, a))
+			}
+		}
+		p = append(p, fp)
+	}
+	return p, nil
+}
+
+// Missed returns the number of sampled entries that weren't blocked
+func (p Probes) Missed() (i int) {
+	for _, f := range p {
+		i += len(f.Missed)
+	}
+	return i
+}
+
+// Sampled returns the number of entries sampled
+func (p Probes) Sampled() (i int) {
+	for _, f := range p {
+		i += f.Sampled
+	}
+	return i
+}
+
+// String renders the probe report, followed by the entries that weren't blocked
+func (p Probes) String() string {
+	if len(p) == 0 {
+		return "No blacklist files were found\n"
+	}
+
+	var (
+		b strings.Builder
+		w = tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	)
+
+	fmt.Fprintln(w, strings.Join([]string{"file", "sampled", "missed"}, "\t"))
+	for _, f := range p {
+		fmt.Fprintln(w, strings.Join([]string{f.File, strconv.Itoa(f.Sampled), strconv.Itoa(len(f.Missed))}, "\t"))
+	}
+	_ = w.Flush()
+
+	for _, f := range p {
+		for _, m := range f.Missed {
+			fmt.Fprintf(&b, "%s: not blocked: %s\n", f.File, m)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,99 @@
+package edgeos
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+
+	"github.com/britannic/blacklist/internal/dnsmasq"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// fakeQuerier answers from a map of names to addresses; names that aren't in it are NXDOMAIN
+type fakeQuerier map[string][]string
+
+func (f fakeQuerier) Lookup(name string) (*dnsmasq.Answer, error) {
+	return f.lookup(name, false)
+}
+
+func (f fakeQuerier) Lookup6(name string) (*dnsmasq.Answer, error) {
+	return f.lookup(name, true)
+}
+
+// lookup answers with name's IPv4 or IPv6 addresses, as an A or AAAA query would
+func (f fakeQuerier) lookup(name string, ip6 bool) (*dnsmasq.Answer, error) {
+	if name == "timeout.com" {
+		return nil, errors.New("timeout.com: i/o timeout")
+	}
+	ips, ok := f[name]
+	a := &dnsmasq.Answer{NXDomain: !ok}
+	for _, ip := range ips {
+		if (net.ParseIP(ip).To4() == nil) == ip6 {
+			a.IPs = append(a.IPs, ip)
+		}
+	}
+	return a, nil
+}
+
+func TestProbe(t *testing.T) {
+	Convey("Testing Probe()", t, func() {
+		dir, err := ioutil.TempDir("/tmp", "testBlacklist")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		c := NewConfig(
+			Dir(dir),
+			Ext("blacklist.conf"),
+			FileNameFmt("%v/%v.%v.%v"),
+		)
+
+		Convey("No blacklist files", func() {
+			p, err := c.Probe(fakeQuerier{}, 10)
+			So(err, ShouldBeNil)
+			So(p.String(), ShouldEqual, "No blacklist files were found\n")
+		})
+
+		Convey("Blacklist files that dnsmasq has and hasn't loaded", func() {
+			files := map[string]string{
+				"domains.malc0de.blacklist.conf":      "address=/bad.com/0.0.0.0\naddress=/worse.com/0.0.0.0\n",
+				"domains.six.blacklist.conf":          "address=/six.com/::\n",
+				"hosts.adaway.blacklist.conf":         "address=/ads.com/192.168.168.1\naddress=/leaked.com/192.168.168.1\naddress=/timeout.com/192.168.168.1\n",
+				"roots.whitelisted.blacklist.conf":    "server=/good.com/#\n",
+				"allowlists.allowlist.blacklist.conf": "server=/school.edu/1.1.1.1\naddress=/#/0.0.0.0\n",
+			}
+			for f, s := range files {
+				So(ioutil.WriteFile(dir+"/"+f, []byte(s), 0644), ShouldBeNil)
+			}
+
+			q := fakeQuerier{
+				"bad.com":    {"0.0.0.0"},
+				"six.com":    {"::"},
+				"ads.com":    {"192.168.168.1"},
+				"leaked.com": {"93.184.216.34"},
+			}
+
+			p, err := c.Probe(q, 10)
+			So(err, ShouldBeNil)
+			So(p.Sampled(), ShouldEqual, 6)
+			So(p.Missed(), ShouldEqual, 2)
+			So(p.String(), ShouldEqual, expProbe)
+		})
+
+		Convey("A malformed blacklist file", func() {
+			So(ioutil.WriteFile(dir+"/domains.broken.blacklist.conf", []byte("address=bad.com\n"), 0644), ShouldBeNil)
+			_, err := c.Probe(fakeQuerier{}, 10)
+			So(err.Error(), ShouldEqual, dir+"/domains.broken.blacklist.conf: line 1: malformed address=bad.com")
+		})
+	})
+}
+
+var expProbe = `file                              sampled  missed
+roots.whitelisted.blacklist.conf  0        0
+domains.malc0de.blacklist.conf    2        0
+domains.six.blacklist.conf        1        0
+hosts.adaway.blacklist.conf       3        2
+hosts.adaway.blacklist.conf: not blocked: leaked.com: 93.184.216.34
+hosts.adaway.blacklist.conf: not blocked: timeout.com: i/o timeout
+`
@@ -0,0 +1,77 @@
+package edgeos
+
+import (
+	"strings"
+
+	"github.com/britannic/blacklist/internal/parse"
+)
+
+const (
+	protect   = "protect"
+	unprotect = "unprotect"
+)
+
+// firmware are the Ubiquiti firmware update and download servers, which are always protected
+// unless unprotected
+var firmware = []string{
+	"dl.ubnt.com",
+	"dl.ui.com",
+	"fw-download.ubnt.com",
+	"fw-update.ubnt.com",
+	"fw-update.ui.com",
+}
+
+// infrastructure are the paths of the router configuration values naming servers it depends on
+var infrastructure = [][]string{
+	{"service", "dns", "forwarding", "name-server"},
+	{"service", "unms", "connection"},
+	{"system", "name-server"},
+	{"system", "ntp", "server"},
+	{"system", "package", "repository", "url"},
+}
+
+// protected returns a *trie of the names that are never blocked; these are the firmware
+// servers, the router's NTP servers, upstream name servers, package repositories and
+// controller, and the root node's protect leaves, less its unprotect leaves
+func protected(root *parse.Node, b *source) *trie {
+	names := append([]string{}, firmware...)
+	for _, p := range infrastructure {
+		for _, v := range root.Values(p...) {
+			names = append(names, hostname(v))
+		}
+	}
+
+	if b != nil {
+		names = append(names, b.protect...)
+	}
+
+	drop := make(map[string]bool)
+	if b != nil {
+		for _, x := range b.unprotect {
+			drop[strings.ToLower(x)] = true
+		}
+	}
+
+	t := newTrie()
+	for _, x := range names {
+		// name servers are usually IP addresses, which normalize rejects
+		k, err := normalize([]byte(x))
+		if err != nil || drop[string(k)] {
+			continue
+		}
+		t.set(k)
+	}
+	return t
+}
+
+// hostname returns the host of a URL or a controller connection string, e.g.
+// wss://unms.example.org:443+key+allowUntrustedCertificate, or v if it has no scheme
+func hostname(v string) string {
+	if i := strings.Index(v, "://"); i >= 0 {
+		v = v[i+3:]
+	}
+	if i := strings.IndexAny(v, ":/+"); i >= 0 {
+		v = v[:i]
+	}
+	return v
+}
@@ -0,0 +1,125 @@
+package edgeos
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/britannic/blacklist/internal/parse"
+	"github.com/britannic/blacklist/internal/tdata"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestProtected(t *testing.T) {
+	Convey("Testing protected()", t, func() {
+		root, err := parse.Parse(strings.NewReader(tdata.CfgDeleted))
+		So(err, ShouldBeNil)
+
+		Convey("The router's infrastructure and firmware servers are protected", func() {
+			So(protected(root, nil).keys(), ShouldResemble, []string{
+				"0.ubnt.pool.ntp.org",
+				"1.ubnt.pool.ntp.org",
+				"dl.ubnt.com",
+				"dl.ui.com",
+				"fw-download.ubnt.com",
+				"fw-update.ubnt.com",
+				"fw-update.ui.com",
+				"http.us.debian.org",
+				"unifi.helmrock.com",
+			})
+		})
+
+		Convey("Protect and unprotect leaves override them", func() {
+			b := &source{protect: []string{"Updates.Vendor.com"}, unprotect: []string{"dl.ui.com", "unifi.helmrock.com"}}
+			act := protected(root, b)
+			So(act.keyExists([]byte("updates.vendor.com")), ShouldBeTrue)
+			So(act.keyExists([]byte("dl.ui.com")), ShouldBeFalse)
+			So(act.keyExists([]byte("unifi.helmrock.com")), ShouldBeFalse)
+			So(act.keyExists([]byte("fw-update.ui.com")), ShouldBeTrue)
+		})
+	})
+
+	Convey("Testing hostname()", t, func() {
+		for v, exp := range map[string]string{
+			"0.ubnt.pool.ntp.org":                                      "0.ubnt.pool.ntp.org",
+			"http://http.us.debian.org/debian/":                        "http.us.debian.org",
+			"wss://unms.example.org:443+key+allowUntrustedCertificate": "unms.example.org",
+			"208.67.220.220":                                           "208.67.220.220",
+		} {
+			So(hostname(v), ShouldEqual, exp)
+		}
+	})
+}
+
+func TestProtectedMerge(t *testing.T) {
+	Convey("Testing protected names in ProcessContent()", t, func() {
+		dir, err := ioutil.TempDir("/tmp", "testBlacklist")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		So(ioutil.WriteFile(dir+"/domains.list", []byte("ubnt.com\nads.com\npool.ntp.org\n"), 0644), ShouldBeNil)
+		So(ioutil.WriteFile(dir+"/hosts.list", []byte("fw-update.ubnt.com\nmine.vendor.com\ntrack.com\n"), 0644), ShouldBeNil)
+
+		c := NewConfig(
+			Dir(dir),
+			Ext("blacklist.conf"),
+			FileNameFmt("%v/%v.%v.%v"),
+			Logger(newLog()),
+			Prefix("address=", "server="),
+		)
+		So(c.Blacklist(&CFGstatic{Cfg: fmt.Sprintf(cfgProtect, dir)}), ShouldBeNil)
+		So(c.Boot(), ShouldContainSubstring, "protect mine.vendor.com\n    unprotect dl.ui.com\n")
+
+		for _, o := range []IFace{ExRtObj, FileObj} {
+			ct, err := c.NewContent(o)
+			So(err, ShouldBeNil)
+			So(c.ProcessContent(ct), ShouldBeNil)
+		}
+
+		for f, exp := range map[string]string{
+			"domains.threats.blacklist.conf": "address=/ads.com/0.0.0.0\n",
+			"hosts.trackers.blacklist.conf":  "address=/track.com/0.0.0.0\n",
+		} {
+			act, err := ioutil.ReadFile(dir + "/" + f)
+			So(err, ShouldBeNil)
+			So(string(act), ShouldEqual, exp)
+		}
+
+		dropped, _, _, kept := c.GetTotalStats()
+		So(dropped, ShouldEqual, 4)
+		So(kept, ShouldEqual, 2)
+	})
+}
+
+var cfgProtect = `system {
+    ntp {
+        server 0.pool.ntp.org {
+        }
+    }
+}
+service {
+    dns {
+        forwarding {
+            blacklist {
+                dns-redirect-ip 0.0.0.0
+                protect mine.vendor.com
+                unprotect dl.ui.com
+                domains {
+                    source threats {
+                        file %[1]s/domains.list
+                        prefix ""
+                    }
+                }
+                hosts {
+                    source trackers {
+                        file %[1]s/hosts.list
+                        prefix ""
+                    }
+                }
+            }
+        }
+    }
+}
+`
@@ -0,0 +1,204 @@
+package edgeos
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/britannic/blacklist/internal/dnsmasq"
+)
+
+// Reload strategies
+const (
+	restart   = "restart"
+	sighup    = "sighup"
+	sysReload = "reload"
+)
+
+const (
+	hostsExt  = "hosts"
+	systemctl = "/bin/systemctl"
+)
+
+// the kinds of blacklist file change
+const (
+	hostsChange int32 = 1 << iota
+	confChange
+)
+
+// Reloads are the strategies ReloadDNS can use: restart runs the DNSsvc command, sighup signals
+// the dnsmasq process in PIDfile and reload runs systemctl reload dnsmasq
+var Reloads = []string{restart, sighup, sysReload}
+
+// hostsFmt returns true if the reload strategy only makes dnsmasq re-read its hosts files
+func (e *Env) hostsFmt() bool {
+	return e.Reload == sighup || e.Reload == sysReload
+}
+
+// addnHosts returns the dnsmasq configuration file naming HostsDir in an addn-hosts directive
+func (e *Env) addnHosts() string {
+	return e.Dir + "/blacklist.addn-hosts.conf"
+}
+
+// hostsFile returns true if a source of type t is written as a hosts format file in HostsDir;
+// only hosts sources are, since a hosts entry doesn't block its subdomains as address= does
+func (e *Env) hostsFile(t ntype) bool {
+	return e != nil && e.hostsFmt() && (t == host || t == preHost)
+}
+
+// changes records that a blacklist file has been written or removed
+func (e *Env) changes(file string) {
+	kind := confChange
+	if strings.HasSuffix(file, "."+hostsExt) {
+		kind = hostsChange
+	}
+
+	e.ctr.Lock()
+	e.changed |= kind
+	if kind == confChange {
+		e.confs = append(e.confs, file)
+	}
+	e.ctr.Unlock()
+}
+
+// Changed returns true if any blacklist file has been written or removed, so dnsmasq needs reloading
+func (c *Config) Changed() bool {
+	c.ctr.RLock()
+	defer c.ctr.RUnlock()
+	return c.changed != 0
+}
+
+// addnHostsConf writes the addn-hosts directive file when the blacklist is written in hosts
+// format and removes it when it isn't
+func (c *Config) addnHostsConf() error {
+	f := c.addnHosts()
+	if !c.hostsFmt() {
+		if _, err := os.Stat(f); err != nil {
+			return nil
+		}
+		c.changes(f)
+		return os.Remove(f)
+	}
+
+	if err := os.MkdirAll(c.HostsDir, 0755); err != nil {
+		return err
+	}
+	b := &bList{file: f, r: strings.NewReader("addn-hosts=" + c.HostsDir + "\n"), size: 1}
+	if err := b.writeFile(); err != nil {
+		return err
+	}
+	if b.wrote {
+		c.changes(f)
+	}
+	return nil
+}
+
+// blacklistFiles returns the roots, domains and hosts blacklist files, including those in hosts format
+func (c *Config) blacklistFiles() ([]string, error) {
+	var files []string
+	for _, area := range []string{roots, domains, hosts} {
+		f, err := filepath.Glob(fmt.Sprintf(c.FnFmt, c.Dir, area, "*", c.Ext))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f...)
+	}
+
+	if c.HostsDir != "" {
+		f, err := filepath.Glob(fmt.Sprintf(c.FnFmt, c.HostsDir, hosts, "*", hostsExt))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f...)
+	}
+	return files, nil
+}
+
+// blocked loads the entries of blacklist files, whichever format they're in
+func blocked(files ...string) (dnsmasq.Conf, error) {
+	var conf, hf []string
+	for _, f := range files {
+		if strings.HasSuffix(f, "."+hostsExt) {
+			hf = append(hf, f)
+			continue
+		}
+		conf = append(conf, f)
+	}
+
+	b, err := dnsmasq.Load(conf...)
+	if err != nil {
+		return nil, err
+	}
+	h, err := dnsmasq.LoadHosts(hf...)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range h {
+		b[k] = v
+	}
+	return b, nil
+}
+
+// Blocked returns the entries of the roots, domains and hosts blacklist files
+func (c *Config) Blocked() (dnsmasq.Conf, error) {
+	files, err := c.blacklistFiles()
+	if err != nil {
+		return nil, err
+	}
+	return blocked(files...)
+}
+
+// ReloadDNS reloads dnsmasq using the Reload strategy, running commands directly rather than
+// through a shell. sighup and reload only make dnsmasq re-read its hosts files, which only hosts
+// sources are written as, so dnsmasq is restarted instead, with a warning, whenever a blacklist
+// configuration file has changed: a domains source, the allowlist, safe search or addn-hosts file
+func (c *Config) ReloadDNS() ([]byte, error) {
+	c.ctr.RLock()
+	confs := append([]string(nil), c.confs...)
+	c.ctr.RUnlock()
+
+	switch {
+	case len(confs) > 0:
+		if c.hostsFmt() {
+			sort.Strings(confs)
+			c.Log.Warningf("%s only makes dnsmasq re-read its hosts files, so it's restarted as %s changed", c.Reload, strings.Join(confs, ", "))
+		}
+	case c.Reload == sighup:
+		return nil, c.hup()
+	case c.Reload == sysReload:
+		return exec.Command(systemctl, sysReload, "dnsmasq").CombinedOutput()
+	}
+
+	f := strings.Fields(c.DNSsvc)
+	if len(f) == 0 {
+		return nil, errors.New("no dnsmasq restart command has been set")
+	}
+	// nolint
+	return exec.Command(f[0], f[1:]...).CombinedOutput()
+}
+
+// hup signals the dnsmasq process in PIDfile to re-read its hosts files
+func (c *Config) hup() error {
+	b, err := ioutil.ReadFile(c.PIDfile)
+	if err != nil {
+		return err
+	}
+
+	pid, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil {
+		return fmt.Errorf("%s doesn't hold a process ID: %v", c.PIDfile, err)
+	}
+
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	return p.Signal(syscall.SIGHUP)
+}
@@ -0,0 +1,138 @@
+package edgeos
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestHup(t *testing.T) {
+	Convey("Testing ReloadDNS() with the sighup strategy", t, func() {
+		dir, err := ioutil.TempDir("/tmp", "testBlacklist")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		defer signal.Stop(hup)
+
+		pid := dir + "/dnsmasq.pid"
+		So(ioutil.WriteFile(pid, []byte(strconv.Itoa(os.Getpid())+"\n"), 0644), ShouldBeNil)
+
+		_, err = NewConfig(DNSsvc("false"), PIDfile(pid), Reload(sighup)).ReloadDNS()
+		So(err, ShouldBeNil)
+		select {
+		case <-hup:
+		case <-time.After(time.Second):
+			So("no SIGHUP", ShouldBeEmpty)
+		}
+
+		So(ioutil.WriteFile(pid, []byte("dnsmasq\n"), 0644), ShouldBeNil)
+		_, err = NewConfig(PIDfile(pid), Reload(sighup)).ReloadDNS()
+		So(err, ShouldBeError, pid+` doesn't hold a process ID: strconv.Atoi: parsing "dnsmasq": invalid syntax`)
+	})
+}
+
+func TestHostsFormat(t *testing.T) {
+	Convey("Testing hosts format blacklist files", t, func() {
+		dir, err := ioutil.TempDir("/tmp", "testBlacklist")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		So(ioutil.WriteFile(dir+"/first.list", []byte("a.com\nb.com\n"), 0644), ShouldBeNil)
+		So(ioutil.WriteFile(dir+"/second.list", []byte("c.com\n"), 0644), ShouldBeNil)
+
+		var (
+			addn  = dir + "/blacklist.addn-hosts.conf"
+			conf  = dir + "/domains.second.blacklist.conf"
+			hosts = dir + "/hosts/hosts.first.hosts"
+		)
+
+		run := func(reload string) *Config {
+			c := NewConfig(
+				Dir(dir),
+				Ext("blacklist.conf"),
+				FileNameFmt("%v/%v.%v.%v"),
+				HostsDir(dir+"/hosts"),
+				Logger(newLog()),
+				Prefix("address=", "server="),
+				Reload(reload),
+				State(dir+"/blacklist.state.json"),
+				WCard(Wildcard{Node: "*s", Name: "*"}),
+			)
+			So(c.Blacklist(&CFGstatic{Cfg: fmt.Sprintf(cfgHostsFormat, dir)}), ShouldBeNil)
+			So(c.GetAll().Files().Remove(), ShouldBeNil)
+
+			ct, err := c.NewContent(FileObj)
+			So(err, ShouldBeNil)
+			So(c.ProcessContent(ct), ShouldBeNil)
+			return c
+		}
+
+		read := func(f string) string {
+			b, err := ioutil.ReadFile(f)
+			So(err, ShouldBeNil)
+			return string(b)
+		}
+
+		c := run(sighup)
+		So(read(hosts), ShouldEqual, "0.0.0.0 a.com\n0.0.0.0 b.com\n")
+		So(read(conf), ShouldEqual, "address=/c.com/0.0.0.0\n")
+		So(read(addn), ShouldEqual, "addn-hosts="+dir+"/hosts\n")
+		So(c.changed, ShouldEqual, hostsChange|confChange)
+
+		b, err := c.Blocked()
+		So(err, ShouldBeNil)
+		So(b.Keys(), ShouldResemble, []string{"a.com", "b.com", "c.com"})
+
+		Convey("Only hosts file changes are reloaded with a SIGHUP", func() {
+			So(ioutil.WriteFile(dir+"/first.list", []byte("a.com\n"), 0644), ShouldBeNil)
+			c := run(sighup)
+			So(read(hosts), ShouldEqual, "0.0.0.0 a.com\n")
+			So(c.changed, ShouldEqual, hostsChange)
+
+			So(run(sighup).Changed(), ShouldBeFalse)
+		})
+
+		Convey("Switching back to restarts removes the hosts format files", func() {
+			c := run(restart)
+			So(c.changed, ShouldEqual, hostsChange|confChange)
+			So(read(dir+"/hosts.first.blacklist.conf"), ShouldEqual, "address=/a.com/0.0.0.0\naddress=/b.com/0.0.0.0\n")
+			for _, f := range []string{addn, hosts} {
+				_, err := os.Stat(f)
+				So(os.IsNotExist(err), ShouldBeTrue)
+			}
+		})
+
+		Convey("A temporary exception rewrites the hosts format file", func() {
+			f, err := c.Allow("b.com", time.Minute)
+			So(err, ShouldBeNil)
+			So(f, ShouldResemble, []string{hosts})
+			So(read(hosts), ShouldEqual, "0.0.0.0 a.com\n")
+		})
+	})
+}
+
+var cfgHostsFormat = `blacklist {
+    dns-redirect-ip 0.0.0.0
+    domains {
+        source second {
+            file %[1]s/second.list
+            prefix ""
+        }
+    }
+    hosts {
+        source first {
+            file %[1]s/first.list
+            prefix ""
+        }
+    }
+}
+`
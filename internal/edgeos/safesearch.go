@@ -0,0 +1,157 @@
+package edgeos
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	redirect   = "redirect"
+	safeSearch = "safe-search"
+	target     = "target"
+)
+
+// lookupIP resolves safe search endpoints; it's a variable so tests can stub it
+var lookupIP = net.LookupIP
+
+// safeSearchHosts maps search engine and video hostnames to their restricted mode endpoints;
+// a safe-search redirect overrides or adds to it
+var safeSearchHosts = map[string]string{
+	"duckduckgo.com":           "safe.duckduckgo.com",
+	"google.com":               "forcesafesearch.google.com",
+	"m.youtube.com":            "restrict.youtube.com",
+	"www.bing.com":             "strict.bing.com",
+	"www.duckduckgo.com":       "safe.duckduckgo.com",
+	"www.google.com":           "forcesafesearch.google.com",
+	"www.youtube-nocookie.com": "restrict.youtube.com",
+	"www.youtube.com":          "restrict.youtube.com",
+	"youtube.googleapis.com":   "restrict.youtube.com",
+	"youtubei.googleapis.com":  "restrict.youtube.com",
+}
+
+// SafeSearchFile returns the safe search dnsmasq configuration file name
+func (c *Config) SafeSearchFile() string {
+	return fmt.Sprintf(c.FnFmt, c.Dir, "restrictions", safeSearch, c.Ext)
+}
+
+// redirects returns the built in safe search endpoints merged with the configured redirects
+func (c *Config) redirects() map[string]string {
+	r := make(map[string]string, len(safeSearchHosts))
+	for h, t := range safeSearchHosts {
+		r[h] = t
+	}
+	for h, t := range c.tree[safeSearch].redirect {
+		r[strings.ToLower(h)] = strings.ToLower(t)
+	}
+	return r
+}
+
+// SafeSearch writes the safe search dnsmasq configuration if the safe-search node is enabled;
+// each hostname is a cname= of its restricted mode endpoint, which dnsmasq only answers when
+// it knows the endpoint's addresses, so they're resolved and written as host-record= lines.
+// A redirect to an IP address is written as an address= line.
+func (c *Config) SafeSearch() error {
+	if !c.nodeExists(safeSearch) || c.tree[safeSearch].disabled {
+		return nil
+	}
+
+	var (
+		addrs   = make(map[string]*list)
+		lines   []string
+		n       int
+		records = make(map[string][]string)
+	)
+
+	for h, t := range c.redirects() {
+		k, err := normalize([]byte(h))
+		if err != nil {
+			c.Log.Warningf("%s: ignoring %v", safeSearch, err)
+			continue
+		}
+		h = string(k)
+
+		if ip := net.ParseIP(t); ip != nil {
+			if addrs[ip.String()] == nil {
+				addrs[ip.String()] = &list{RWMutex: &sync.RWMutex{}, entry: make(entry)}
+			}
+			addrs[ip.String()].set(k)
+			n++
+			continue
+		}
+
+		if k, err = normalize([]byte(t)); err != nil {
+			c.Log.Warningf("%s: ignoring %s target %v", safeSearch, h, err)
+			continue
+		}
+		t = string(k)
+
+		if _, ok := records[t]; !ok {
+			records[t] = endpoint(t)
+		}
+		if len(records[t]) == 0 {
+			c.Log.Warningf("%s: unable to resolve %s, so %s isn't restricted", safeSearch, t, h)
+			continue
+		}
+		if l := fmt.Sprintf("cname=%s,%s", h, t); safeLine.MatchString(l) {
+			lines = append(lines, l+"\n")
+			n++
+		}
+	}
+
+	for t, ips := range records {
+		for _, ip := range ips {
+			if l := fmt.Sprintf("host-record=%s,%s", t, ip); safeLine.MatchString(l) {
+				lines = append(lines, l+"\n")
+			}
+		}
+	}
+	sort.Strings(lines)
+
+	var (
+		ips  = make([]string, 0, len(addrs))
+		r    []io.Reader
+		size = len(lines)
+	)
+	for ip := range addrs {
+		ips = append(ips, ip)
+	}
+	sort.Strings(ips)
+
+	for _, ip := range ips {
+		r = append(r, formatData(c.Pfx.domain+"/%v/"+ip, addrs[ip]))
+		size += len(addrs[ip].entry)
+	}
+	r = append(r, strings.NewReader(strings.Join(lines, "")))
+
+	c.Log.Infof("%s: restricting %d hostnames", safeSearch, n)
+
+	b := &bList{
+		file: c.SafeSearchFile(),
+		r:    io.MultiReader(r...),
+		size: size,
+	}
+	if err := b.writeFile(); err != nil {
+		return err
+	}
+	if b.wrote {
+		c.changes(b.file)
+	}
+	return nil
+}
+
+// endpoint returns the addresses of a restricted mode endpoint
+func endpoint(t string) (ips []string) {
+	addrs, err := lookupIP(t)
+	if err != nil {
+		return nil
+	}
+	for _, ip := range addrs {
+		ips = append(ips, ip.String())
+	}
+	sort.Strings(ips)
+	return ips
+}
@@ -0,0 +1,126 @@
+package edgeos
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSafeSearch(t *testing.T) {
+	Convey("Testing SafeSearch()", t, func() {
+		dir, err := ioutil.TempDir("/tmp", "testBlacklist")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		lookup := lookupIP
+		defer func() { lookupIP = lookup }()
+		lookupIP = func(host string) ([]net.IP, error) {
+			switch host {
+			case "forcesafesearch.google.com":
+				return []net.IP{net.ParseIP("216.239.38.120"), net.ParseIP("2001:4860:4802:32::78")}, nil
+			case "restrictmoderate.youtube.com":
+				return []net.IP{net.ParseIP("216.239.38.119")}, nil
+			case "safe.duckduckgo.com":
+				return []net.IP{net.ParseIP("52.142.124.215")}, nil
+			case "strict.bing.com":
+				return []net.IP{net.ParseIP("204.79.197.220")}, nil
+			}
+			return nil, errors.New("no such host")
+		}
+
+		newConfig := func(disabled string) *Config {
+			c := NewConfig(
+				Dir(dir),
+				Ext("blacklist.conf"),
+				FileNameFmt("%v/%v.%v.%v"),
+				Logger(newLog()),
+				Prefix("address=", "server="),
+			)
+			So(c.Blacklist(&CFGstatic{Cfg: fmt.Sprintf(cfgSafeSearch, disabled)}), ShouldBeNil)
+			return c
+		}
+
+		Convey("Hostnames are redirected to their restricted mode endpoints", func() {
+			c := newConfig("false")
+			So(c.Disabled, ShouldBeFalse)
+			So(c.SafeSearch(), ShouldBeNil)
+			So(c.SafeSearchFile(), ShouldEqual, dir+"/restrictions.safe-search.blacklist.conf")
+
+			act, err := ioutil.ReadFile(c.SafeSearchFile())
+			So(err, ShouldBeNil)
+			So(string(act), ShouldEqual, expSafeSearch)
+		})
+
+		Convey("Hostnames and targets are normalized and invalid ones are ignored", func() {
+			c := newConfig("false")
+			c.tree[safeSearch].redirect = map[string]string{
+				"search.school.org.": "forcesafesearch.google.com.",
+				"bad.school.org":     "forcesafesearch.google.com,evil.com\nconf-file=/etc/passwd",
+				"bad host.com":       "forcesafesearch.google.com",
+			}
+			So(c.SafeSearch(), ShouldBeNil)
+
+			act, err := ioutil.ReadFile(c.SafeSearchFile())
+			So(err, ShouldBeNil)
+			So(string(act), ShouldContainSubstring, "\ncname=search.school.org,forcesafesearch.google.com\n")
+			So(string(act), ShouldNotContainSubstring, "bad")
+			So(string(act), ShouldNotContainSubstring, "conf-file")
+		})
+
+		Convey("Testing Boot() round trip serialisation", func() {
+			c := newConfig("false")
+			d := NewConfig()
+			So(d.Blacklist(&CFGstatic{Cfg: c.Boot()}), ShouldBeNil)
+			So(d.Boot(), ShouldEqual, c.Boot())
+			So(c.Boot(), ShouldContainSubstring, "        redirect www.google.co.uk {\n            target forcesafesearch.google.com\n        }\n")
+		})
+
+		Convey("Disabled safe search isn't written and doesn't disable the blacklist", func() {
+			c := newConfig("true")
+			So(c.Disabled, ShouldBeFalse)
+			So(c.SafeSearch(), ShouldBeNil)
+
+			_, err := os.Stat(c.SafeSearchFile())
+			So(os.IsNotExist(err), ShouldBeTrue)
+		})
+	})
+}
+
+var (
+	cfgSafeSearch = `blacklist {
+    dns-redirect-ip 0.0.0.0
+    safe-search {
+        disabled %s
+        redirect school.search.com {
+            target 10.0.0.53
+        }
+        redirect www.google.co.uk {
+            target forcesafesearch.google.com
+        }
+        redirect www.youtube.com {
+            target restrictmoderate.youtube.com
+        }
+    }
+}
+`
+
+	expSafeSearch = `address=/school.search.com/10.0.0.53
+cname=duckduckgo.com,safe.duckduckgo.com
+cname=google.com,forcesafesearch.google.com
+cname=www.bing.com,strict.bing.com
+cname=www.duckduckgo.com,safe.duckduckgo.com
+cname=www.google.co.uk,forcesafesearch.google.com
+cname=www.google.com,forcesafesearch.google.com
+cname=www.youtube.com,restrictmoderate.youtube.com
+host-record=forcesafesearch.google.com,2001:4860:4802:32::78
+host-record=forcesafesearch.google.com,216.239.38.120
+host-record=restrictmoderate.youtube.com,216.239.38.119
+host-record=safe.duckduckgo.com,52.142.124.215
+host-record=strict.bing.com,204.79.197.220
+`
+)
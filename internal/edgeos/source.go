@@ -6,10 +6,12 @@ import (
 	"fmt"
 	"io"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
 
+	"github.com/britannic/blacklist/internal/parse"
 	"github.com/britannic/blacklist/internal/regx"
 )
 
@@ -17,27 +19,40 @@ import (
 type source struct {
 	*Env
 	Objects
-	desc     string
-	disabled bool
-	err      error
-	exc      []string
-	file     string
-	inc      []string
-	ip       string
-	iface    IFace
-	ltype    string
-	nType    ntype
-	name     string
-	prefix   string
-	r        io.Reader
-	url      string
-}
-
-func (s *source) addSource(srcName [][]byte, n string) {
-	if bytes.Equal(srcName[1], []byte(src)) {
-		s.name = string(srcName[2])
-		s.nType = getType(n).(ntype)
-	}
+	aggregate  int
+	catalog    string
+	category   []string
+	conflict   string
+	desc       string
+	disabled   bool
+	err        error
+	exc        []string
+	family     string
+	file       string
+	gpg        string
+	inc        []string
+	ip         string
+	iface      IFace
+	ltype      string
+	maxChange  int
+	method     string
+	maxEntries int
+	minEntries int
+	minisign   string
+	nType      ntype
+	name       string
+	prefix     string
+	prefixed   bool // the configuration has a prefix leaf, even an empty one
+	priority   int
+	probe      []string
+	protect    []string
+	r          io.Reader
+	redirect   map[string]string
+	seen       entry
+	sha256     string
+	unprotect  []string
+	upstream   []string
+	url        string
 }
 
 func (s *source) area() string {
@@ -57,15 +72,20 @@ func (s *source) excludes() io.Reader {
 }
 
 func (s *source) filename(area string) string {
+	dir, ext := s.Dir, s.Ext
+	if s.hostsFile(s.nType) {
+		dir, ext = s.HostsDir, hostsExt
+	}
+
 	switch s.nType {
 	case excRoot, preRoot:
-		return fmt.Sprintf(s.FnFmt, s.Dir, roots, s.name, s.Ext)
+		return fmt.Sprintf(s.FnFmt, dir, roots, s.name, ext)
 	case excDomn, preDomn:
-		return fmt.Sprintf(s.FnFmt, s.Dir, domains, s.name, s.Ext)
+		return fmt.Sprintf(s.FnFmt, dir, domains, s.name, ext)
 	case excHost, preHost:
-		return fmt.Sprintf(s.FnFmt, s.Dir, hosts, s.name, s.Ext)
+		return fmt.Sprintf(s.FnFmt, dir, hosts, s.name, ext)
 	}
-	return fmt.Sprintf(s.FnFmt, s.Dir, area, s.name, s.Ext)
+	return fmt.Sprintf(s.FnFmt, dir, area, s.name, ext)
 }
 
 // includes returns an io.Reader of blacklist includes
@@ -74,13 +94,6 @@ func (s *source) includes() io.Reader {
 	return strings.NewReader(strings.Join(s.inc, "\n"))
 }
 
-func isntSource(nx []string) bool {
-	if len(nx) < 1 {
-		return true
-	}
-	return nx[len(nx)-1] != src
-}
-
 func newSource() *source {
 	return &source{
 		Objects: Objects{},
@@ -89,6 +102,144 @@ func newSource() *source {
 	}
 }
 
+// node returns the source as a config.boot *parse.Node; tnodes are named by kind, sources by tag
+func (s *source) node(kind, tag string) *parse.Node {
+	var (
+		n    = &parse.Node{Block: true, Name: kind, Value: tag}
+		leaf = func(name, value string, quoted bool) {
+			if value != "" || quoted {
+				n.Children = append(n.Children, &parse.Node{Name: name, Value: value, Quoted: quoted})
+			}
+		}
+	)
+
+	if s.aggregate > 0 {
+		leaf(aggregate, strconv.Itoa(s.aggregate), false)
+	}
+	for _, x := range s.category {
+		leaf(category, x, false)
+	}
+	leaf(conflicts, s.conflict, false)
+	if tag == "" || s.disabled {
+		leaf(disabled, booltoStr(s.disabled), false)
+	}
+	leaf("description", s.desc, s.desc != "")
+	leaf(blackhole, s.ip, false)
+	for _, x := range s.exc {
+		leaf("exclude", x, false)
+	}
+	for _, x := range s.inc {
+		leaf("include", x, false)
+	}
+	leaf(files, s.file, false)
+	leaf(family, s.family, false)
+	leaf(gpgKey, s.gpg, false)
+	if s.maxChange > 0 {
+		leaf(maxChange, strconv.Itoa(s.maxChange), false)
+	}
+	if s.maxEntries > 0 {
+		leaf(maxEntries, strconv.Itoa(s.maxEntries), false)
+	}
+	if s.minEntries > 0 {
+		leaf(minEntries, strconv.Itoa(s.minEntries), false)
+	}
+	leaf(method, s.method, false)
+	leaf(minisignKey, s.minisign, false)
+	// an empty prefix is only written if it was configured, so round trips are byte for byte
+	if tag != "" && (s.prefix != "" || s.prefixed) {
+		leaf("prefix", s.prefix, true)
+	}
+	if s.priority != 0 {
+		leaf(priority, strconv.Itoa(s.priority), false)
+	}
+	for _, x := range s.probe {
+		leaf(probe, x, false)
+	}
+	leaf(checksum, s.sha256, false)
+	for _, x := range s.protect {
+		leaf(protect, x, false)
+	}
+	for _, x := range s.unprotect {
+		leaf(unprotect, x, false)
+	}
+	for _, x := range s.upstream {
+		leaf(upstream, x, false)
+	}
+	rd := make([]string, 0, len(s.redirect))
+	for h := range s.redirect {
+		rd = append(rd, h)
+	}
+	sort.Strings(rd)
+	for _, h := range rd {
+		n.Children = append(n.Children, &parse.Node{
+			Block:    true,
+			Name:     redirect,
+			Value:    h,
+			Children: []*parse.Node{{Name: target, Value: s.redirect[h]}},
+		})
+	}
+	leaf(urls, s.url, false)
+
+	for _, x := range s.src {
+		// curated sources come from the catalog, not the configuration
+		if x.catalog == "" {
+			n.Children = append(n.Children, x.node(src, x.name))
+		}
+	}
+	return n
+}
+
+// newSourceNode returns a *source built from a source tag node, or nil if it has neither a url nor a file
+func newSourceNode(n *parse.Node, tnode string) *source {
+	if !n.Block {
+		return nil
+	}
+
+	s := newSource()
+	s.name = n.Value
+	s.nType = getType(tnode).(ntype)
+
+	for _, l := range n.Children {
+		switch l.Name {
+		case "description":
+			s.desc = l.Value
+		case blackhole:
+			s.ip = l.Value
+		case disabled:
+			s.disabled, _ = strToBool(l.Value)
+		case "exclude":
+			s.exc = append(s.exc, l.Value)
+		case files:
+			s.file, s.ltype = l.Value, files
+		case gpgKey:
+			s.gpg = l.Value
+		case "include":
+			s.inc = append(s.inc, l.Value)
+		case maxChange:
+			s.maxChange, _ = strconv.Atoi(l.Value)
+		case maxEntries:
+			s.maxEntries, _ = strconv.Atoi(l.Value)
+		case minEntries:
+			s.minEntries, _ = strconv.Atoi(l.Value)
+		case minisignKey:
+			s.minisign = l.Value
+		case "prefix":
+			s.prefix, s.prefixed = l.Value, true
+		case priority:
+			s.priority, _ = strconv.Atoi(l.Value)
+		case checksum:
+			s.sha256 = l.Value
+		case urls:
+			s.url, s.ltype = l.Value, urls
+		}
+	}
+
+	if s.ltype == "" {
+		return nil
+	}
+	return s
+}
+
 func (s *source) setFilePrefix(format string) string {
 	switch s.nType {
 	case excDomn, preDomn:
@@ -116,17 +267,97 @@ func pad(s string) string {
 	return fmt.Sprintf("%s %-*s", s, 13-len(s), " ")
 }
 
-// Process extracts hosts/domains from downloaded raw content
-func (s *source) process() *bList {
+// rank orders source types for processing: pre-configured blacklists, then whitelists,
+// then domains before hosts, so that hosts are checked against blacklisted domains
+func (s *source) rank() int {
+	switch s.nType {
+	case preRoot:
+		return 0
+	case preDomn:
+		return 1
+	case preHost:
+		return 2
+	case excRoot:
+		return 3
+	case excDomn:
+		return 4
+	case excHost:
+		return 5
+	case domn, root:
+		return 6
+	case host:
+		return 7
+	}
+	return 8
+}
+
+// sortSources sorts sources into processing order by rank, then priority (lowest first) and name
+func sortSources(srcs []*source) {
+	sort.SliceStable(srcs, func(i, j int) bool {
+		a, b := srcs[i], srcs[j]
+		switch {
+		case a.rank() != b.rank():
+			return a.rank() < b.rank()
+		case a.priority != b.priority:
+			return a.priority < b.priority
+		}
+		return a.name < b.name
+	})
+}
+
+// own returns a source's whitelist and blacklist, which only apply to url and file sources
+func (s *source) own() (exc *list, inc []string) {
+	exc = &list{RWMutex: &sync.RWMutex{}, entry: make(entry)}
+	switch s.ltype {
+	case files, urls:
+		for _, x := range s.exc {
+			exc.set([]byte(strings.ToLower(x)))
+		}
+		inc = s.inc
+	}
+	return exc, inc
+}
+
+// parsed holds the candidate entries extracted from a source, in the order they were found
+type parsed struct {
+	*source
+	agg       *aggregator
+	conflicts []string
+	dropped   int
+	exempt    *trie
+	extracted int
+	fqdns     [][]byte
+	invalid   int
+	protect   *trie
+	rules     *rules
+}
+
+// parse extracts candidate hosts/domains from downloaded raw content, dropping those on the
+// source's own whitelist; it only uses the source's own state, so sources can be parsed concurrently
+func (s *source) parse() *parsed {
 	var (
-		area                     = typeInt(s.nType)
-		b                        = bufio.NewScanner(s.r)
-		dropped, extracted, kept int
-		find                     = regx.NewRegex()
-		l                        = list{RWMutex: &sync.RWMutex{}, entry: make(entry)}
-		ok                       bool
+		b        = bufio.NewScanner(s.r)
+		exc, inc = s.own()
+		find     = regx.NewRegex()
+		ok       bool
+		p        = &parsed{source: s}
 	)
-	// if b != nil {
+
+	add := func(fqdn []byte) {
+		p.extracted++
+		fqdn, err := normalize(fqdn)
+		if err != nil {
+			p.invalid++
+			s.Log.Debugf("%s: %v", s.name, err)
+			return
+		}
+		if exc.subKeyExists(fqdn) {
+			p.dropped++
+			return
+		}
+		p.fqdns = append(p.fqdns, fqdn)
+	}
+
 	for b.Scan() {
 		line := bytes.ToLower(bytes.TrimSpace(b.Bytes()))
 
@@ -136,37 +367,124 @@ func (s *source) process() *bList {
 		case bytes.HasPrefix(line, []byte(s.prefix)):
 			if line, ok = find.StripPrefixAndSuffix(line, s.prefix); ok {
 				for _, fqdn := range find.RX[regx.FQDN].FindAll(line, -1) {
-					extracted++
-					if s.Dex.subKeyExists(fqdn) {
-						dropped++
-						continue
-					}
-					if !s.Exc.keyExists(fqdn) {
-						kept++
-						s.Exc.set(fqdn)
-						l.set(fqdn)
-						continue
-					}
-					dropped++
+					add(fqdn)
 				}
 			}
 		}
 	}
-	// }
-	switch s.nType {
-	case domn, excDomn, excRoot:
-		s.Dex.merge(&l)
+
+	for _, fqdn := range inc {
+		add([]byte(strings.ToLower(fqdn)))
 	}
 
-	s.sum(area, dropped, extracted, kept)
+	return p
+}
+
+// merge drops whitelisted and duplicate entries against the shared Dex and Exc tries; merges
+// must run one at a time in source order, so that the source keeping a duplicate is deterministic.
+// Domains are merged parents first and added to Dex as they're kept, so that their subdomains
+// are dropped from this and later sources.
+func (p *parsed) merge() *bList {
+	var (
+		area    = typeInt(p.nType)
+		block   = p.protect != nil
+		dropped = p.dropped
+		dex     bool
+		guarded []string
+		kept    int
+		l       = list{RWMutex: &sync.RWMutex{}, entry: make(entry)}
+	)
+
+	switch p.nType {
+	case excDomn, excHost, excRoot:
+		block = false
+	}
+
+	switch p.nType {
+	case domn, excDomn, excRoot, preDomn, preRoot:
+		dex = true
+		sort.SliceStable(p.fqdns, func(i, j int) bool {
+			return bytes.Count(p.fqdns[i], []byte(".")) < bytes.Count(p.fqdns[j], []byte("."))
+		})
+	}
+
+	if p.Overlap && (p.ltype == files || p.ltype == urls) {
+		p.seen = make(entry)
+	}
+
+	for _, fqdn := range p.fqdns {
+		// every entry the source lists counts towards the overlap, including those another
+		// source already keeps
+		if p.seen != nil {
+			p.seen[string(fqdn)] = struct{}{}
+		}
+		if p.Dex.subKeyExists(fqdn) {
+			dropped++
+			continue
+		}
+		if p.Exc.keyExists(fqdn) {
+			dropped++
+			continue
+		}
+		// dnsmasq blocks subdomains too, so a protected name can't be under a blocked entry
+		if block && p.protect.under(fqdn) {
+			dropped++
+			guarded = append(guarded, string(fqdn))
+			continue
+		}
+		// temporary exceptions allow their subdomains too
+		if block && p.exempt != nil && p.exempt.subKeyExists(fqdn) {
+			dropped++
+			continue
+		}
+		if block && p.overrides(fqdn) {
+			dropped++
+			continue
+		}
+		kept++
+		p.Exc.set(fqdn)
+		l.set(fqdn)
+		if dex {
+			p.Dex.set(fqdn)
+		}
+	}
+
+	if p.agg != nil {
+		for _, x := range p.agg.collapse(&l) {
+			p.Log.Infof("%s: aggregated %d hosts into %s", p.name, x.hosts, x.domain)
+			p.Dex.set([]byte(x.domain))
+			p.Exc.set([]byte(x.domain))
+		}
+		dropped += kept - len(l.entry)
+		kept = len(l.entry)
+	}
+
+	if guarded != nil {
+		p.Log.Warningf("%s.%s: not blocking protected %s", p.area(), p.name, strings.Join(guarded, ", "))
+	}
+
+	if p.conflicts != nil {
+		act := "blocking"
+		if p.rules.exclude {
+			act = "excluding"
+		}
+		p.Log.Warningf("%s.%s: %s %d entries that conflict with existing dnsmasq rules", p.area(), p.name, act, len(p.conflicts))
+	}
+
+	p.sum(area, dropped, p.extracted, p.invalid, kept)
 
 	return &bList{
-		file: s.filename(area),
-		r:    formatData(getDnsmasqPrefix(s), &l),
+		file: p.filename(area),
+		r:    formatData(getDnsmasqPrefix(p.source), &l),
 		size: kept,
 	}
 }
 
+// process extracts hosts/domains from downloaded raw content and merges them
+func (s *source) process() *bList {
+	return s.parse().merge()
+}
+
 // Stringer for *source
 func (s *source) String() string {
 	a := func(s string) string {
@@ -196,11 +514,12 @@ func (s *source) String() string {
 	)
 }
 
-func (s *source) sum(area string, dropped, extracted, kept int) {
+func (s *source) sum(area string, dropped, extracted, invalid, kept int) {
 	// Let's do some accounting
 	ctr := s.ctr.stat
 	atomic.AddInt32(&ctr[area].dropped, int32(dropped))
 	atomic.AddInt32(&ctr[area].extracted, int32(extracted))
+	atomic.AddInt32(&ctr[area].invalid, int32(invalid))
 	atomic.AddInt32(&ctr[area].kept, int32(kept))
 
 	switch {
@@ -208,7 +527,10 @@ func (s *source) sum(area string, dropped, extracted, kept int) {
 		s.Log.Infof("%s: downloaded: %d", s.name, extracted)
 		s.Log.Infof("%s: extracted: %d", s.name, kept)
 		s.Log.Infof("%s: dropped: %d", s.name, dropped)
-	case extracted > 0 && dropped == extracted:
+		if invalid > 0 {
+			s.Log.Infof("%s: invalid: %d", s.name, invalid)
+		}
+	case extracted > 0 && dropped+invalid == extracted:
 		s.Log.Warningf("%s: 0 records processed - check source and/or configuration", s.name)
 	}
 }
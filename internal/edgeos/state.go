@@ -0,0 +1,193 @@
+package edgeos
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	maxChange  = "max-change"
+	maxEntries = "max-entries"
+	minEntries = "min-entries"
+)
+
+// state records each url and file source's entry count from the last run that applied it, the
+// temporary exceptions made with Allow, with when they expire, a hash of each blacklist file's
+// inputs when it was written and when the last bundle imported was created
+type state struct {
+	Allowed map[string]time.Time `json:"allowed,omitempty"`
+	Bundle  *time.Time           `json:"bundle,omitempty"`
+	Inputs  map[string]string    `json:"inputs,omitempty"`
+	Sources map[string]int       `json:"sources"`
+}
+
+// SourceReport records a url or file source's entry count for the run report, the
+// threshold it tripped, if it did, and any source's conflicts with existing dnsmasq rules
+type SourceReport struct {
+	Name      string
+	Previous  int
+	Entries   int
+	Tripped   string
+	Conflicts []string
+}
+
+// Report is the run report of the url and file sources processed
+type Report []*SourceReport
+
+// loadState reads the state file, starting afresh if it doesn't exist or can't be read, and
+// drops the exceptions that have expired
+func (c *Config) loadState() *state {
+	s := &state{Allowed: make(map[string]time.Time), Inputs: make(map[string]string), Sources: make(map[string]int)}
+	if c.State == "" {
+		return s
+	}
+
+	b, err := ioutil.ReadFile(c.State)
+	if err == nil {
+		err = json.Unmarshal(b, s)
+	}
+	if err != nil {
+		c.Debug(fmt.Sprintf("Starting a new state file %s: %v", c.State, err))
+		s.Sources = make(map[string]int)
+		s.Allowed, s.Inputs = nil, nil
+	}
+	if s.Allowed == nil {
+		s.Allowed = make(map[string]time.Time)
+	}
+	if s.Inputs == nil {
+		s.Inputs = make(map[string]string)
+	}
+
+	now := time.Now()
+	for k, t := range s.Allowed {
+		if !now.Before(t) {
+			c.Log.Noticef("Temporary exception for %s expired at %s", k, t.Format(time.RFC3339))
+			delete(s.Allowed, k)
+		}
+	}
+	return s
+}
+
+// saveState writes the state file
+func (c *Config) saveState() error {
+	if c.State == "" {
+		return nil
+	}
+
+	b, err := json.MarshalIndent(c.state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(c.State, append(b, '\n'), 0644)
+}
+
+// guard compares a url or file source's entry count with its thresholds and previous count,
+// records it in the run report and returns why it tripped a threshold, if it did
+func (c *Config) guard(p *parsed) string {
+	if p.ltype != files && p.ltype != urls || p.err != nil {
+		return ""
+	}
+
+	var (
+		n        = len(p.fqdns)
+		name     = p.area() + "." + p.name
+		prev, ok = c.state.Sources[name]
+		why      string
+	)
+
+	switch {
+	case p.minEntries > 0 && n < p.minEntries:
+		why = fmt.Sprintf("%d entries is below the minimum of %d", n, p.minEntries)
+	case p.maxEntries > 0 && n > p.maxEntries:
+		why = fmt.Sprintf("%d entries is above the maximum of %d", n, p.maxEntries)
+	case p.maxChange > 0 && ok && prev > 0 && abs(n-prev)*100 > p.maxChange*prev:
+		why = fmt.Sprintf("%d entries is more than a %d%% change from %d", n, p.maxChange, prev)
+	}
+
+	c.report = append(c.report, &SourceReport{Name: name, Previous: prev, Entries: n, Tripped: why})
+	if why == "" {
+		c.state.Sources[name] = n
+	}
+	return why
+}
+
+// Report returns the run report
+func (c *Config) Report() Report {
+	return c.report
+}
+
+// String renders the run report, followed by the entries that conflict with existing dnsmasq rules
+func (r Report) String() string {
+	if len(r) == 0 {
+		return "No url or file sources were processed\n"
+	}
+
+	var (
+		b strings.Builder
+		w = tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	)
+
+	fmt.Fprintln(w, strings.Join([]string{"source", "previous", "entries", "status"}, "\t"))
+	for _, s := range r {
+		status := "applied"
+		if s.Tripped != "" {
+			status = "kept previous: " + s.Tripped
+		}
+		fmt.Fprintln(w, strings.Join([]string{s.Name, strconv.Itoa(s.Previous), strconv.Itoa(s.Entries), status}, "\t"))
+	}
+
+	_ = w.Flush()
+
+	for _, s := range r {
+		for _, x := range s.Conflicts {
+			fmt.Fprintf(&b, "%s: %s\n", s.Name, x)
+		}
+	}
+	return b.String()
+}
+
+// Status renders each url and file source's entry count from the last run that applied it,
+// followed by the temporary exceptions and when they expire
+func (c *Config) Status() string {
+	if c.state == nil {
+		c.state = c.loadState()
+	}
+
+	var (
+		b strings.Builder
+		w = tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	)
+
+	names := make([]string, 0, len(c.state.Sources))
+	for k := range c.state.Sources {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(w, "source\tentries")
+	for _, k := range names {
+		fmt.Fprintf(w, "%s\t%d\n", k, c.state.Sources[k])
+	}
+	fmt.Fprintln(w)
+
+	fmt.Fprintln(w, "exception\texpires")
+	for _, k := range exceptions(c.state.Allowed) {
+		fmt.Fprintf(w, "%s\t%s\n", k, c.state.Allowed[k].Local().Format(time.RFC3339))
+	}
+	_ = w.Flush()
+
+	return b.String()
+}
+
+func abs(i int) int {
+	if i < 0 {
+		return -i
+	}
+	return i
+}
@@ -0,0 +1,112 @@
+package edgeos
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestGuard(t *testing.T) {
+	Convey("Testing source thresholds across runs", t, func() {
+		dir, err := ioutil.TempDir("/tmp", "testBlacklist")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		run := func(entries int) (*Config, string) {
+			var b strings.Builder
+			for i := 0; i < entries; i++ {
+				fmt.Fprintf(&b, "ads%d.com\n", i)
+			}
+			So(ioutil.WriteFile(dir+"/hosts.list", []byte(b.String()), 0644), ShouldBeNil)
+
+			c := NewConfig(
+				Dir(dir),
+				Ext("blacklist.conf"),
+				FileNameFmt("%v/%v.%v.%v"),
+				Logger(newLog()),
+				Prefix("address=", "server="),
+				State(dir+"/blacklist.state.json"),
+			)
+			So(c.Blacklist(&CFGstatic{Cfg: fmt.Sprintf(cfgGuard, dir)}), ShouldBeNil)
+
+			ct, err := c.NewContent(FileObj)
+			So(err, ShouldBeNil)
+			So(c.ProcessContent(ct), ShouldBeNil)
+
+			act, err := ioutil.ReadFile(dir + "/hosts.guarded.blacklist.conf")
+			if os.IsNotExist(err) {
+				return c, ""
+			}
+			So(err, ShouldBeNil)
+			return c, string(act)
+		}
+
+		Convey("Below the minimum, nothing is written on the first run", func() {
+			c, act := run(2)
+			So(act, ShouldBeEmpty)
+			So(c.Report(), ShouldResemble, Report{
+				{Name: "hosts.guarded", Entries: 2, Tripped: "2 entries is below the minimum of 3"},
+			})
+			_, err := os.Stat(dir + "/blacklist.state.json")
+			So(err, ShouldBeNil)
+		})
+
+		Convey("Above the maximum, the previous output is kept", func() {
+			_, exp := run(10)
+			c, act := run(21)
+			So(act, ShouldEqual, exp)
+			So(c.Report()[0].Tripped, ShouldEqual, "21 entries is above the maximum of 20")
+		})
+
+		Convey("A change of more than max-change percent keeps the previous output", func() {
+			_, exp := run(10)
+			So(strings.Count(exp, "\n"), ShouldEqual, 10)
+
+			c, act := run(4)
+			So(act, ShouldEqual, exp)
+			So(c.Report()[0], ShouldResemble, &SourceReport{
+				Name:     "hosts.guarded",
+				Previous: 10,
+				Entries:  4,
+				Tripped:  "4 entries is more than a 50% change from 10",
+			})
+
+			c, act = run(15)
+			So(strings.Count(act, "\n"), ShouldEqual, 15)
+			So(c.Report().String(), ShouldEqual, "source         previous  entries  status\nhosts.guarded  10        15       applied\n")
+
+			c, _ = run(6)
+			So(c.Report().String(), ShouldEqual, "source         previous  entries  status\nhosts.guarded  15        6        kept previous: 6 entries is more than a 50% change from 15\n")
+
+			b, err := ioutil.ReadFile(dir + "/blacklist.state.json")
+			So(err, ShouldBeNil)
+			var s state
+			So(json.Unmarshal(b, &s), ShouldBeNil)
+			So(s.Sources, ShouldResemble, map[string]int{"hosts.guarded": 15})
+			So(s.Inputs, ShouldContainKey, dir+"/hosts.guarded.blacklist.conf")
+		})
+	})
+
+	Convey("Testing an empty run report", t, func() {
+		So(NewConfig().Report().String(), ShouldEqual, "No url or file sources were processed\n")
+	})
+}
+
+var cfgGuard = `blacklist {
+    dns-redirect-ip 0.0.0.0
+    hosts {
+        source guarded {
+            file %[1]s/hosts.list
+            max-change 50
+            max-entries 20
+            min-entries 3
+            prefix ""
+        }
+    }
+}
+`
@@ -0,0 +1,149 @@
+package edgeos
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// trie is a reversed-label domain trie with a RW Mutex, e.g. ads.example.com is stored
+// as com -> example -> ads, so parent domains share their labels and lookups take one
+// map probe per label
+type trie struct {
+	*sync.RWMutex
+	root *tnode
+	size int
+}
+
+// tnode is a trie label; end is true if the domain ending at this label is a member
+type tnode struct {
+	end  bool
+	kids map[string]*tnode
+}
+
+func newTrie() *trie {
+	return &trie{RWMutex: &sync.RWMutex{}, root: &tnode{}}
+}
+
+// labels calls f with each label of k from right to left, stopping if f returns false
+func labels(k []byte, f func(label []byte) bool) {
+	end := len(k)
+	for i := len(k) - 1; i >= -1; i-- {
+		if i == -1 || k[i] == '.' {
+			if !f(k[i+1 : end]) {
+				return
+			}
+			end = i
+		}
+	}
+}
+
+// keyExists returns true if k is a member
+func (t *trie) keyExists(k []byte) bool {
+	t.RLock()
+	defer t.RUnlock()
+
+	n := t.root
+	labels(k, func(l []byte) bool {
+		n = n.kids[string(l)]
+		return n != nil
+	})
+	return n != nil && n.end
+}
+
+// len returns the number of members
+func (t *trie) len() int {
+	t.RLock()
+	defer t.RUnlock()
+	return t.size
+}
+
+// set adds k as a member
+func (t *trie) set(k []byte) {
+	t.Lock()
+	defer t.Unlock()
+
+	n := t.root
+	labels(k, func(l []byte) bool {
+		if n.kids == nil {
+			n.kids = make(map[string]*tnode)
+		}
+		next, ok := n.kids[string(l)]
+		if !ok {
+			next = &tnode{}
+			n.kids[string(l)] = next
+		}
+		n = next
+		return true
+	})
+
+	if !n.end {
+		n.end = true
+		t.size++
+	}
+}
+
+// subKeyExists returns true if k or any of its parent domains is a member
+func (t *trie) subKeyExists(k []byte) (ok bool) {
+	t.RLock()
+	defer t.RUnlock()
+
+	n := t.root
+	labels(k, func(l []byte) bool {
+		if n = n.kids[string(l)]; n == nil {
+			return false
+		}
+		ok = n.end
+		return !ok
+	})
+	return ok
+}
+
+// under returns true if k or any domain beneath it is a member
+func (t *trie) under(k []byte) bool {
+	t.RLock()
+	defer t.RUnlock()
+
+	n := t.root
+	labels(k, func(l []byte) bool {
+		n = n.kids[string(l)]
+		return n != nil
+	})
+	return n != nil && (n.end || len(n.kids) > 0)
+}
+
+// keys returns the members in lexicographical order
+func (t *trie) keys() []string {
+	t.RLock()
+	defer t.RUnlock()
+
+	var (
+		k    = make([]string, 0, t.size)
+		walk func(n *tnode, name string)
+	)
+
+	walk = func(n *tnode, name string) {
+		if n.end {
+			k = append(k, name)
+		}
+		for l, c := range n.kids {
+			if name != "" {
+				l += "." + name
+			}
+			walk(c, l)
+		}
+	}
+	walk(t.root, "")
+
+	sort.Strings(k)
+	return k
+}
+
+func (t *trie) String() string {
+	var b strings.Builder
+	for _, k := range t.keys() {
+		fmt.Fprintf(&b, "%q:%v,\n", k, struct{}{})
+	}
+	return b.String()
+}
@@ -0,0 +1,94 @@
+package edgeos
+
+import (
+	"sync"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestTrie(t *testing.T) {
+	Convey("Testing trie", t, func() {
+		tr := newTrie()
+		for _, k := range keyArray {
+			tr.set(k)
+		}
+		tr.set(keyArray[0])
+
+		Convey("Testing keyExists()", func() {
+			for _, k := range keyArray {
+				So(tr.keyExists(k), ShouldBeTrue)
+			}
+			So(tr.keyExists([]byte("zKeyDoesn'tExist")), ShouldBeFalse)
+			So(tr.keyExists([]byte("com")), ShouldBeFalse)
+			So(tr.keyExists([]byte("seven.six.intellitxt.com")), ShouldBeFalse)
+			So(tr.keyExists([]byte("")), ShouldBeFalse)
+		})
+
+		Convey("Testing subKeyExists()", func() {
+			for _, k := range keyArray {
+				So(tr.subKeyExists(k), ShouldBeTrue)
+			}
+			So(tr.subKeyExists([]byte("ads.intellitxt.com")), ShouldBeTrue)
+			So(tr.subKeyExists([]byte("notintellitxt.com")), ShouldBeFalse)
+			So(tr.subKeyExists([]byte("zKeyDoesn'tExist")), ShouldBeFalse)
+			So(tr.subKeyExists([]byte("com")), ShouldBeFalse)
+		})
+
+		Convey("Testing under()", func() {
+			So(tr.under([]byte("intellitxt.com")), ShouldBeTrue)
+			So(tr.under([]byte("com")), ShouldBeTrue)
+			So(tr.under([]byte("four.five.six.intellitxt.com")), ShouldBeTrue)
+			So(tr.under([]byte("ads.intellitxt.com")), ShouldBeFalse)
+			So(tr.under([]byte("org")), ShouldBeFalse)
+		})
+
+		Convey("Testing len() and keys()", func() {
+			So(tr.len(), ShouldEqual, len(keyArray))
+			So(tr.keys(), ShouldResemble, []string{
+				"five.six.intellitxt.com",
+				"four.five.six.intellitxt.com",
+				"intellitxt.com",
+				"one.two.three.four.five.six.intellitxt.com",
+				"six.intellitxt.com",
+				"three.four.five.six.intellitxt.com",
+				"top.one.two.three.four.five.six.intellitxt.com",
+				"two.three.four.five.six.intellitxt.com",
+			})
+		})
+	})
+
+	Convey("Testing trie.String()", t, func() {
+		tr := newTrie()
+		for k := range act.entry {
+			tr.set([]byte(k))
+		}
+		So(tr.String(), ShouldEqual, act.String())
+		So(newTrie().String(), ShouldEqual, "")
+	})
+}
+
+func BenchmarkSubKeyExists(b *testing.B) {
+	var (
+		k  = []byte("ads.tracker.top.one.two.three.four.five.six.example.com")
+		l  = list{RWMutex: &sync.RWMutex{}, entry: make(entry)}
+		tr = newTrie()
+	)
+
+	for _, x := range keyArray {
+		l.set(x)
+		tr.set(x)
+	}
+
+	b.Run("list", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			l.subKeyExists(k)
+		}
+	})
+
+	b.Run("trie", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			tr.subKeyExists(k)
+		}
+	})
+}
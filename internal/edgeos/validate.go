@@ -0,0 +1,293 @@
+package edgeos
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/britannic/blacklist/internal/catalog"
+	"github.com/britannic/blacklist/internal/parse"
+)
+
+// Severity labels how serious a configuration Diagnostic is
+type Severity int
+
+// Severity levels for configuration diagnostics
+const (
+	Warning Severity = iota
+	Error
+)
+
+// Diagnostic describes a problem found in a blacklist configuration
+type Diagnostic struct {
+	Severity Severity
+	Line     int
+	Path     string
+	Msg      string
+}
+
+// Diagnostics is a slice of *Diagnostic
+type Diagnostics []*Diagnostic
+
+// leaves maps each blacklist node type to the leaves it accepts
+var leaves = map[string][]string{
+	rootNode:     {category, conflicts, disabled, blackhole, "exclude", "include", protect, unprotect},
+	allowlist:    {disabled, blackhole, "include", upstream},
+	connectivity: {disabled, family, method, probe},
+	domains:      {disabled, blackhole, "exclude", "include"},
+	hosts:        {aggregate, disabled, blackhole, "exclude", "include"},
+	redirect:     {target},
+	safeSearch:   {disabled},
+	src:          {"description", disabled, blackhole, "exclude", files, gpgKey, "include", maxChange, maxEntries, minEntries, minisignKey, "prefix", priority, checksum, urls},
+}
+
+// validator holds the state of a configuration validation pass
+type validator struct {
+	cat   *catalog.Catalog
+	diags Diagnostics
+}
+
+func (s Severity) String() string {
+	if s == Error {
+		return "error"
+	}
+	return "warning"
+}
+
+// Error implements the error interface for *Diagnostic
+func (d *Diagnostic) Error() string {
+	return d.String()
+}
+
+func (d *Diagnostic) String() string {
+	if d.Path == "" {
+		return fmt.Sprintf("%s: line %d: %s", d.Severity, d.Line, d.Msg)
+	}
+	return fmt.Sprintf("%s: line %d: %s: %s", d.Severity, d.Line, d.Path, d.Msg)
+}
+
+// Errors returns the number of Error severity diagnostics
+func (d Diagnostics) Errors() (i int) {
+	for _, x := range d {
+		if x.Severity == Error {
+			i++
+		}
+	}
+	return i
+}
+
+// Warnings returns the number of Warning severity diagnostics
+func (d Diagnostics) Warnings() int {
+	return len(d) - d.Errors()
+}
+
+func (d Diagnostics) String() string {
+	s := make([]string, len(d))
+	for i, x := range d {
+		s[i] = x.String()
+	}
+	return strings.Join(s, "\n")
+}
+
+// Validate checks a blacklist configuration and returns any errors and warnings
+// found, together with their line numbers and node paths
+func (c *Config) Validate(r ConfLoader) Diagnostics {
+	v := &validator{}
+
+	cat, err := c.catalog()
+	if err != nil {
+		v.warnf(0, "", "using the built in catalog, because %v", err)
+	}
+	v.cat = cat
+
+	root, err := parse.Parse(r.read())
+	if errs, ok := err.(parse.ErrorList); ok {
+		for _, e := range errs {
+			v.errorf(e.Line, "", "%s", e.Msg)
+		}
+	}
+
+	b := root.Find(rootNode)
+	if b == nil {
+		v.errorf(0, "", "no blacklist configuration has been detected")
+		return v.diags
+	}
+
+	v.node(b, rootNode, rootNode)
+
+	sort.SliceStable(v.diags, func(i, j int) bool { return v.diags[i].Line < v.diags[j].Line })
+
+	return v.diags
+}
+
+func (v *validator) add(sev Severity, line int, path, f string, args ...interface{}) {
+	v.diags = append(v.diags, &Diagnostic{Severity: sev, Line: line, Path: path, Msg: fmt.Sprintf(f, args...)})
+}
+
+func (v *validator) errorf(line int, path, f string, args ...interface{}) {
+	v.add(Error, line, path, f, args...)
+}
+
+func (v *validator) warnf(line int, path, f string, args ...interface{}) {
+	v.add(Warning, line, path, f, args...)
+}
+
+// child returns the kind of a child node or "" if it isn't a known node
+func child(kind string, n *parse.Node) string {
+	switch {
+	case !n.Block:
+		return ""
+	case kind == rootNode && n.Value == "" && (n.Name == allowlist || n.Name == connectivity || n.Name == domains || n.Name == hosts || n.Name == safeSearch):
+		return n.Name
+	case kind == safeSearch && n.Value != "" && n.Name == redirect:
+		return redirect
+	case (kind == domains || kind == hosts) && n.Value != "" && n.Name == src:
+		return src
+	}
+	return ""
+}
+
+// isLeaf returns true if name is a leaf accepted by the kind of node
+func isLeaf(kind, name string) bool {
+	for _, l := range leaves[kind] {
+		if l == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (v *validator) leaf(n *parse.Node, path string) {
+	switch n.Name {
+	case blackhole, upstream:
+		if net.ParseIP(n.Value) == nil {
+			v.errorf(n.Line, path, "%s %s is not a valid IP address", n.Name, n.Value)
+		}
+	case category:
+		if !v.cat.Has(n.Value) {
+			v.errorf(n.Line, path, "%s %s isn't in the catalog, which has %s", n.Name, n.Value, strings.Join(v.cat.Categories(), ", "))
+		}
+	case conflicts:
+		if n.Value != exclude && n.Value != warn {
+			v.errorf(n.Line, path, "%s %s must be %s or %s", n.Name, n.Value, warn, exclude)
+		}
+	case method:
+		if n.Value != head && n.Value != tcpChk {
+			v.errorf(n.Line, path, "%s %s must be %s or %s", n.Name, n.Value, tcpChk, head)
+		}
+	case disabled:
+		if _, err := strToBool(n.Value); err != nil {
+			v.errorf(n.Line, path, "%s %s must be true or false", n.Name, n.Value)
+		}
+	case family:
+		if _, ok := families[n.Value]; !ok {
+			v.errorf(n.Line, path, "%s %s must be ipv4, ipv6 or any", n.Name, n.Value)
+		}
+	case probe:
+		if u, err := url.Parse(n.Value); err == nil && u.Host != "" {
+			if u.Scheme != "http" && u.Scheme != "https" {
+				v.errorf(n.Line, path, "%s %s must use the http or https scheme", n.Name, n.Value)
+			}
+			return
+		}
+		if _, port, err := net.SplitHostPort(n.Value); err != nil || port == "" {
+			v.errorf(n.Line, path, "%s %s must be a host:port or a url", n.Name, n.Value)
+		}
+	case aggregate, maxChange, maxEntries, minEntries, priority:
+		if p, err := strconv.Atoi(n.Value); err != nil || p < 0 {
+			v.errorf(n.Line, path, "%s %s must be a whole number of 0 or more", n.Name, n.Value)
+		}
+	case protect, target, unprotect:
+		// a redirect target may also be an IP address
+		if n.Name == target && net.ParseIP(n.Value) != nil {
+			return
+		}
+		if _, err := normalize([]byte(n.Value)); err != nil {
+			v.errorf(n.Line, path, "%s %s is not a valid domain: %v", n.Name, n.Value, err)
+		}
+	case checksum:
+		if b, err := hex.DecodeString(n.Value); err != nil || len(b) != sha256.Size {
+			v.errorf(n.Line, path, "%s %s must be 64 hexadecimal characters", n.Name, n.Value)
+		}
+	case minisignKey:
+		if b, err := base64.StdEncoding.DecodeString(n.Value); err != nil || len(b) != 42 || string(b[:2]) != "Ed" {
+			v.errorf(n.Line, path, "%s %s is not a minisign public key", n.Name, n.Value)
+		}
+	case files, gpgKey:
+		f, err := os.Open(n.Value)
+		if err != nil {
+			v.errorf(n.Line, path, "%s %s is not readable: %v", n.Name, n.Value, err)
+			return
+		}
+		f.Close()
+	case urls:
+		u, err := url.Parse(n.Value)
+		switch {
+		case err != nil:
+			v.errorf(n.Line, path, "%s %s is not a valid URL: %v", n.Name, n.Value, err)
+		case u.Scheme != "http" && u.Scheme != "https":
+			v.errorf(n.Line, path, "%s %s must use the http or https scheme", n.Name, n.Value)
+		case u.Host == "":
+			v.errorf(n.Line, path, "%s %s has no host", n.Name, n.Value)
+		}
+	}
+}
+
+// node validates a blacklist node of the given kind and its children
+func (v *validator) node(n *parse.Node, kind, path string) {
+	var (
+		names = make(map[string]int)
+		file  bool
+		tgt   bool
+		up    bool
+		url   bool
+	)
+
+	for _, x := range n.Children {
+		p := path + " " + x.Path()
+		switch {
+		case x.Name == "":
+			continue
+		case child(kind, x) != "":
+			if prev, ok := names[x.Path()]; ok {
+				v.errorf(x.Line, p, "duplicate node, first defined on line %d", prev)
+			} else {
+				names[x.Path()] = x.Line
+			}
+			v.node(x, child(kind, x), p)
+		case !x.Block && isLeaf(kind, x.Name):
+			file = file || x.Name == files
+			tgt = tgt || x.Name == target
+			up = up || x.Name == upstream
+			url = url || x.Name == urls
+			v.leaf(x, path)
+		case x.Block:
+			v.warnf(x.Line, p, "unknown node will be ignored")
+		default:
+			v.warnf(x.Line, path, "unknown leaf %q will be ignored", x.Name)
+		}
+	}
+
+	switch {
+	case kind == allowlist && !up:
+		v.errorf(n.Line, path, "allowlist has no upstream resolvers")
+	case kind == redirect && !tgt:
+		v.errorf(n.Line, path, "redirect has no target")
+	}
+
+	if kind == src {
+		switch {
+		case !url && !file:
+			v.errorf(n.Line, path, "source has neither a url nor a file")
+		case url && file:
+			v.errorf(n.Line, path, "source has both a url and a file, only set one or the other")
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package edgeos
+
+import (
+	"testing"
+
+	"github.com/britannic/blacklist/internal/tdata"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestValidateConfig(t *testing.T) {
+	Convey("Testing Validate()", t, func() {
+		tests := []struct {
+			cfg      string
+			errors   int
+			exp      string
+			name     string
+			warnings int
+		}{
+			{
+				name: "a valid configuration",
+				cfg:  cfgValid,
+				exp:  "",
+			},
+			{
+				name:   "a configuration with a stray brace and a missing file",
+				cfg:    tdata.Cfg,
+				errors: 2,
+				exp: `error: line 109: blacklist hosts source tasty: file ../internal/testdata/blist.hosts.src is not readable: open ../internal/testdata/blist.hosts.src: no such file or directory
+error: line 127: unbalanced braces: unexpected closing brace`,
+			},
+			{
+				name:   "an empty configuration",
+				cfg:    "",
+				errors: 1,
+				exp:    "error: line 0: no blacklist configuration has been detected",
+			},
+			{
+				name:     "a configuration with problems",
+				cfg:      cfgInvalid,
+				errors:   7,
+				warnings: 2,
+				exp: `error: line 1: unbalanced braces: node "blacklist" is never closed
+error: line 2: blacklist: disabled maybe must be true or false
+error: line 3: blacklist: dns-redirect-ip 10.0.0.256 is not a valid IP address
+warning: line 4: blacklist: unknown leaf "colour" will be ignored
+warning: line 6: blacklist domains tasty: unknown node will be ignored
+error: line 9: blacklist domains source nourl: source has neither a url nor a file
+error: line 13: blacklist domains source badurl: url ftp://bad.example.com/list must use the http or https scheme
+error: line 15: blacklist domains source nourl: duplicate node, first defined on line 9
+error: line 19: blacklist domains source nofile: file /:~/no/such/file is not readable: open /:~/no/such/file: no such file or directory`,
+			},
+			{
+				name:   "an allowlist without upstream resolvers",
+				cfg:    "blacklist {\n    allowlist {\n        include school.edu\n    }\n}\n",
+				errors: 1,
+				exp:    "error: line 2: blacklist allowlist: allowlist has no upstream resolvers",
+			},
+			{
+				name:   "a safe search redirect without a target",
+				cfg:    "blacklist {\n    safe-search {\n        redirect www.google.co.uk {\n        }\n    }\n}\n",
+				errors: 1,
+				exp:    "error: line 3: blacklist safe-search redirect www.google.co.uk: redirect has no target",
+			},
+			{
+				name:   "a connectivity policy with problems",
+				cfg:    "blacklist {\n    connectivity {\n        family ipv5\n        method ping\n        probe 1.1.1.1:53\n        probe www.google.com\n        probe ftp://ftp.example.com/\n    }\n}\n",
+				errors: 4,
+				exp: `error: line 3: blacklist connectivity: family ipv5 must be ipv4, ipv6 or any
+error: line 4: blacklist connectivity: method ping must be tcp or head
+error: line 6: blacklist connectivity: probe www.google.com must be a host:port or a url
+error: line 7: blacklist connectivity: probe ftp://ftp.example.com/ must use the http or https scheme`,
+			},
+			{
+				name:   "a category that isn't in the catalog",
+				cfg:    "blacklist {\n    category malware\n    category knitting\n}\n",
+				errors: 1,
+				exp:    "error: line 3: blacklist: category knitting isn't in the catalog, which has ads, adult, crypto-mining, gambling, malware, phishing, social, tracking",
+			},
+			{
+				name:   "an unknown conflicts action",
+				cfg:    "blacklist {\n    conflicts ignore\n}\n",
+				errors: 1,
+				exp:    "error: line 2: blacklist: conflicts ignore must be warn or exclude",
+			},
+			{
+				name:   "a configuration with an extra closing brace",
+				cfg:    "blacklist {\n}\n}\n",
+				errors: 1,
+				exp:    "error: line 3: unbalanced braces: unexpected closing brace",
+			},
+		}
+
+		for _, tt := range tests {
+			Convey("with "+tt.name, func() {
+				act := NewConfig().Validate(&CFGstatic{Cfg: tt.cfg})
+				So(act.String(), ShouldEqual, tt.exp)
+				So(act.Errors(), ShouldEqual, tt.errors)
+				So(act.Warnings(), ShouldEqual, tt.warnings)
+			})
+		}
+	})
+}
+
+var (
+	cfgValid = `service {
+    dns {
+        forwarding {
+            blacklist {
+                disabled false
+                dns-redirect-ip 0.0.0.0
+                exclude example.com
+                hosts {
+                    include ads.example.com
+                    source tasty {
+                        description "File source"
+                        dns-redirect-ip 10.10.10.10
+                        file ../testdata/blist.hosts.src
+                    }
+                    source "yoyo list" {
+                        disabled true
+                        exclude good.example.com
+                        include extra.example.com
+                        prefix ""
+                        url https://pgl.yoyo.org/as/serverlist.php?hostformat=nohtml
+                    }
+                }
+            }
+        }
+    }
+}
+/* Warning: Do not remove the following line. */`
+
+	cfgInvalid = `blacklist {
+    disabled maybe
+    dns-redirect-ip 10.0.0.256
+    colour blue
+    domains {
+        tasty {
+            include foo.com
+        }
+        source nourl {
+            description "No URL or file"
+        }
+        source badurl {
+            url ftp://bad.example.com/list
+        }
+        source nourl {
+            url http://good.example.com/list
+        }
+        source nofile {
+            file /:~/no/such/file
+        }
+    }
+    hosts {
+        include ads.example.com
+}`
+)
@@ -0,0 +1,180 @@
+package edgeos
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/openpgp"
+)
+
+const (
+	checksum    = "sha256"
+	gpgKey      = "gpg-key"
+	minisignKey = "minisign-key"
+)
+
+// safeLine matches the only lines written to dnsmasq configuration files: an address= or server=
+// directive for a lower case, punycode encoded domain, with an IP address or # for excludes, the
+// allowlist's catch-all address=/#/ directive, the safe search cname= and host-record= directives,
+// or a hosts format IP address and domain
+var safeLine = func() *regexp.Regexp {
+	const (
+		domain = `[a-z0-9_](?:[a-z0-9_-]*[a-z0-9_])?(?:\.[a-z0-9_](?:[a-z0-9_-]*[a-z0-9_])?)+`
+		ip     = `[0-9a-fA-F.:]+`
+	)
+	return regexp.MustCompile(`^(?:` +
+		`(?:address|server)=/` + domain + `/(?:#|[0-9a-fA-F.:]*)` +
+		`|address=/#/` + ip +
+		`|cname=` + domain + `,` + domain +
+		`|host-record=` + domain + `,` + ip +
+		`|` + ip + ` ` + domain +
+		`)$`)
+}()
+
+// signed returns true if the source has a checksum or signature to verify
+func (s *source) signed() bool {
+	return s.sha256 != "" || s.minisign != "" || s.gpg != ""
+}
+
+// verified reads r and returns its content, or an error if it doesn't match the source's
+// sha256 checksum, minisign signature or GPG signature
+func (s *source) verified(r io.Reader) (io.Reader, error) {
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.sha256 != "" {
+		sum := sha256.Sum256(body)
+		if !strings.EqualFold(hex.EncodeToString(sum[:]), s.sha256) {
+			return nil, fmt.Errorf("%s: sha256 checksum mismatch", s.name)
+		}
+	}
+
+	if s.minisign != "" {
+		sig, err := s.signature(".minisig")
+		if err != nil {
+			return nil, err
+		}
+		if err = minisignVerify(s.minisign, sig, body); err != nil {
+			return nil, fmt.Errorf("%s: %v", s.name, err)
+		}
+	}
+
+	if s.gpg != "" {
+		sig, err := s.signature(".asc")
+		if err != nil {
+			return nil, err
+		}
+		if err = gpgVerify(s.gpg, sig, body); err != nil {
+			return nil, fmt.Errorf("%s: %v", s.name, err)
+		}
+	}
+
+	return bytes.NewReader(body), nil
+}
+
+// signature returns the detached signature published alongside the source's url or file,
+// e.g. https://example.org/hosts.txt.minisig
+func (s *source) signature(ext string) ([]byte, error) {
+	if s.ltype == files {
+		return ioutil.ReadFile(s.file + ext)
+	}
+
+	req, err := http.NewRequest(s.Method, s.url+ext, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", agent)
+
+	resp, err := (&http.Client{}).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: unable to get signature %s: %s", s.name, s.url+ext, resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// minisignVerify checks sig, a minisign signature file, against key, a base64 minisign public key
+func minisignVerify(key string, sig, body []byte) error {
+	pk, err := base64.StdEncoding.DecodeString(strings.TrimSpace(key))
+	if err != nil || len(pk) != 42 || string(pk[:2]) != "Ed" {
+		return errors.New("invalid minisign public key")
+	}
+
+	var lines []string
+	b := bufio.NewScanner(bytes.NewReader(sig))
+	for b.Scan() {
+		lines = append(lines, b.Text())
+	}
+	if len(lines) < 4 || !strings.HasPrefix(lines[2], "trusted comment: ") {
+		return errors.New("invalid minisign signature")
+	}
+
+	s, err := base64.StdEncoding.DecodeString(lines[1])
+	if err != nil || len(s) != 74 {
+		return errors.New("invalid minisign signature")
+	}
+	if !bytes.Equal(s[2:10], pk[2:10]) {
+		return errors.New("minisign signature was made with a different key")
+	}
+
+	msg := body
+	switch string(s[:2]) {
+	case "ED":
+		h := blake2b.Sum512(body)
+		msg = h[:]
+	case "Ed":
+	default:
+		return errors.New("unsupported minisign signature algorithm")
+	}
+
+	pub := ed25519.PublicKey(pk[10:])
+	if !ed25519.Verify(pub, msg, s[10:]) {
+		return errors.New("minisign signature verification failed")
+	}
+
+	// the global signature covers the signature and its trusted comment
+	g, err := base64.StdEncoding.DecodeString(lines[3])
+	m := append(append([]byte{}, s[10:]...), strings.TrimPrefix(lines[2], "trusted comment: ")...)
+	if err != nil || !ed25519.Verify(pub, m, g) {
+		return errors.New("minisign trusted comment verification failed")
+	}
+	return nil
+}
+
+// gpgVerify checks sig, an armored detached signature, against the armored public keyring file
+func gpgVerify(keyring string, sig, body []byte) error {
+	f, err := os.Open(keyring)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	keys, err := openpgp.ReadArmoredKeyRing(f)
+	if err != nil {
+		return err
+	}
+
+	if _, err = openpgp.CheckArmoredDetachedSignature(keys, bytes.NewReader(body), bytes.NewReader(sig)); err != nil {
+		return fmt.Errorf("gpg signature verification failed: %v", err)
+	}
+	return nil
+}
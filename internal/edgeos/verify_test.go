@@ -0,0 +1,163 @@
+package edgeos
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const (
+	testSHA256      = "a888145abcf191a26863ec4d404f8fb4306f8c7d5257ed3fcb91047f772fd1e7"
+	testMinisignKey = "RWQBAgMEBQYHCAOhB7/zzhC+HXDdGOdLwJln5NYwm6UNXx3chmQSVTG4"
+)
+
+func TestVerified(t *testing.T) {
+	Convey("Testing verified()", t, func() {
+		body, err := ioutil.ReadFile("../testdata/signed.list")
+		So(err, ShouldBeNil)
+
+		tests := []struct {
+			name string
+			s    *source
+			body string
+			err  string
+		}{
+			{name: "sha256", s: &source{sha256: strings.ToUpper(testSHA256)}, body: string(body)},
+			{name: "sha256 mismatch", s: &source{sha256: testSHA256}, body: string(body) + "evil.com\n", err: "sha256 checksum mismatch"},
+			{name: "minisign", s: &source{minisign: testMinisignKey}, body: string(body)},
+			{name: "minisign tampered", s: &source{minisign: testMinisignKey}, body: "evil.com\n", err: "minisign signature verification failed"},
+			{name: "minisign wrong key", s: &source{minisign: "RWQICAgICAgICAOhB7/zzhC+HXDdGOdLwJln5NYwm6UNXx3chmQSVTG4"}, body: string(body), err: "different key"},
+			{name: "minisign invalid key", s: &source{minisign: "bogus"}, body: string(body), err: "invalid minisign public key"},
+			{name: "gpg", s: &source{gpg: "../testdata/gpg.pub.asc"}, body: string(body)},
+			{name: "gpg tampered", s: &source{gpg: "../testdata/gpg.pub.asc"}, body: "evil.com\n", err: "gpg signature verification failed"},
+			{name: "gpg missing key", s: &source{gpg: "../testdata/missing.asc"}, body: string(body), err: "no such file"},
+		}
+
+		for _, tt := range tests {
+			Convey("Testing "+tt.name, func() {
+				tt.s.name, tt.s.file, tt.s.ltype = tt.name, "../testdata/signed.list", files
+				So(tt.s.signed(), ShouldBeTrue)
+
+				r, err := tt.s.verified(strings.NewReader(tt.body))
+				if tt.err != "" {
+					So(err, ShouldNotBeNil)
+					So(err.Error(), ShouldContainSubstring, tt.err)
+					So(r, ShouldBeNil)
+					return
+				}
+				So(err, ShouldBeNil)
+				act, err := ioutil.ReadAll(r)
+				So(err, ShouldBeNil)
+				So(string(act), ShouldEqual, tt.body)
+			})
+		}
+
+		So((&source{}).signed(), ShouldBeFalse)
+	})
+}
+
+func TestVerifiedSources(t *testing.T) {
+	Convey("Testing signed sources in ProcessContent()", t, func() {
+		dir, err := ioutil.TempDir("/tmp", "testBlacklist")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		c := NewConfig(
+			Dir(dir),
+			Ext("blacklist.conf"),
+			FileNameFmt("%v/%v.%v.%v"),
+			Logger(newLog()),
+			Prefix("address=", "server="),
+		)
+		So(c.Blacklist(&CFGstatic{Cfg: fmt.Sprintf(cfgSigned, testMinisignKey, testSHA256[1:]+"0")}), ShouldBeNil)
+		So(c.Boot(), ShouldContainSubstring, "minisign-key "+testMinisignKey+"\n")
+
+		ct, err := c.NewContent(FileObj)
+		So(err, ShouldBeNil)
+		err = c.ProcessContent(ct)
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, "pinned: sha256 checksum mismatch")
+
+		act, err := ioutil.ReadFile(dir + "/hosts.signed.blacklist.conf")
+		So(err, ShouldBeNil)
+		So(string(act), ShouldEqual, "address=/ads.signed-list.com/0.0.0.0\naddress=/track.signed-list.com/0.0.0.0\n")
+
+		_, err = os.Stat(dir + "/hosts.pinned.blacklist.conf")
+		So(os.IsNotExist(err), ShouldBeTrue)
+	})
+}
+
+func TestSafeLine(t *testing.T) {
+	Convey("Testing formatData() only writes safe lines", t, func() {
+		l := &list{RWMutex: &sync.RWMutex{}, entry: make(entry)}
+		for _, k := range []string{
+			"ads.com",
+			"xn--bcher-kva.de",
+			"bad.com/1.2.3.4\nconf-file=/etc/passwd",
+			"bad.com/#\nserver=/x.com",
+			"UPPER.com",
+			"nodot",
+			"-leading.com",
+		} {
+			l.set([]byte(k))
+		}
+
+		act, err := ioutil.ReadAll(formatData("address=/%v/0.0.0.0", l))
+		So(err, ShouldBeNil)
+		So(string(act), ShouldEqual, "address=/ads.com/0.0.0.0\naddress=/xn--bcher-kva.de/0.0.0.0\n")
+
+		act, err = ioutil.ReadAll(formatData("server=/%v/#", l))
+		So(err, ShouldBeNil)
+		So(string(act), ShouldEqual, "server=/ads.com/#\nserver=/xn--bcher-kva.de/#\n")
+
+		act, err = ioutil.ReadAll(formatData("conf-file=/%v/0.0.0.0", l))
+		So(err, ShouldBeNil)
+		So(string(act), ShouldBeEmpty)
+	})
+
+	Convey("Testing safeLine matches every directive written", t, func() {
+		for l, exp := range map[string]bool{
+			"address=/ads.com/0.0.0.0":                        true,
+			"server=/ads.com/":                                true,
+			"server=/ads.com/#":                               true,
+			"server=/ads.com/2001:db8::1":                     true,
+			"address=/#/0.0.0.0":                              true,
+			"0.0.0.0 ads.com":                                 true,
+			"cname=www.google.com,forcesafesearch.google.com": true,
+			"host-record=strict.bing.com,204.79.197.220":      true,
+			"address=/#/":                                     false,
+			"address=/#/0.0.0.0\nconf-file=/etc/passwd":       false,
+			"cname=www.google.com,evil.com\nconf-file=/x":     false,
+			"cname=WWW.Google.com,forcesafesearch.google.com": false,
+			"cname=www.google.com":                            false,
+			"host-record=strict.bing.com,evil.com":            false,
+			"conf-file=/etc/passwd":                           false,
+		} {
+			So(safeLine.MatchString(l), ShouldEqual, exp)
+		}
+	})
+}
+
+var cfgSigned = `blacklist {
+    dns-redirect-ip 0.0.0.0
+    hosts {
+        source pinned {
+            file ../testdata/signed.list
+            prefix ""
+            priority 1
+            sha256 %[2]s
+        }
+        source signed {
+            file ../testdata/signed.list
+            minisign-key %[1]s
+            prefix ""
+            priority 2
+        }
+    }
+}
+`
@@ -0,0 +1,178 @@
+// Package parse provides a tokenizer and recursive-descent parser for EdgeOS/VyOS config.boot syntax
+package parse
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Kind labels token types
+type Kind int
+
+// Kind labels for lexical tokens
+const (
+	EOF Kind = iota
+	Comment
+	LBrace
+	NewLine
+	RBrace
+	String
+	Word
+)
+
+// Token is a lexical token with its line number
+type Token struct {
+	Kind Kind
+	Line int
+	Text string
+}
+
+// Lexer splits EdgeOS configuration data into Tokens
+type Lexer struct {
+	errs ErrorList
+	line int
+	r    *bufio.Reader
+}
+
+// NewLexer returns a *Lexer that reads from r
+func NewLexer(r io.Reader) *Lexer {
+	return &Lexer{line: 1, r: bufio.NewReader(r)}
+}
+
+func (k Kind) String() string {
+	switch k {
+	case EOF:
+		return "EOF"
+	case Comment:
+		return "comment"
+	case LBrace:
+		return "'{'"
+	case NewLine:
+		return "newline"
+	case RBrace:
+		return "'}'"
+	case String:
+		return "quoted string"
+	case Word:
+		return "word"
+	}
+	return fmt.Sprintf("Kind(%d)", int(k))
+}
+
+func (t Token) String() string {
+	return fmt.Sprintf("%d:%v:%q", t.Line, t.Kind, t.Text)
+}
+
+// Errors returns any lexical errors found so far
+func (l *Lexer) Errors() ErrorList {
+	return l.errs
+}
+
+// Next returns the next Token
+func (l *Lexer) Next() Token {
+	for {
+		c, err := l.r.ReadByte()
+		if err != nil {
+			return Token{Kind: EOF, Line: l.line}
+		}
+
+		switch c {
+		case ' ', '\t', '\r':
+			continue
+		case '\n':
+			l.line++
+			return Token{Kind: NewLine, Line: l.line - 1}
+		case '{':
+			return Token{Kind: LBrace, Line: l.line, Text: "{"}
+		case '}':
+			return Token{Kind: RBrace, Line: l.line, Text: "}"}
+		case '"':
+			return l.quoted()
+		case '/':
+			if b, _ := l.r.Peek(1); len(b) == 1 && b[0] == '*' {
+				_, _ = l.r.ReadByte()
+				return l.comment()
+			}
+		}
+
+		return l.word(c)
+	}
+}
+
+// comment scans the remainder of a /* ... */ comment, which may span lines
+func (l *Lexer) comment() Token {
+	var (
+		line = l.line
+		s    strings.Builder
+	)
+
+	for {
+		c, err := l.r.ReadByte()
+		if err != nil {
+			l.errs.add(line, "unterminated comment")
+			return Token{Kind: Comment, Line: line, Text: strings.TrimSpace(s.String())}
+		}
+
+		if c == '*' {
+			if b, _ := l.r.Peek(1); len(b) == 1 && b[0] == '/' {
+				_, _ = l.r.ReadByte()
+				return Token{Kind: Comment, Line: line, Text: strings.TrimSpace(s.String())}
+			}
+		}
+
+		if c == '\n' {
+			l.line++
+		}
+		s.WriteByte(c)
+	}
+}
+
+// quoted scans a double quoted string, which may contain braces, escaped quotes and newlines
+func (l *Lexer) quoted() Token {
+	var (
+		line = l.line
+		s    strings.Builder
+	)
+
+	for {
+		c, err := l.r.ReadByte()
+		if err != nil {
+			l.errs.add(line, "unterminated quoted string")
+			return Token{Kind: String, Line: line, Text: s.String()}
+		}
+
+		switch c {
+		case '"':
+			return Token{Kind: String, Line: line, Text: s.String()}
+		case '\\':
+			if b, _ := l.r.Peek(1); len(b) == 1 && (b[0] == '"' || b[0] == '\\') {
+				c, _ = l.r.ReadByte()
+			}
+		case '\n':
+			l.line++
+		}
+		s.WriteByte(c)
+	}
+}
+
+// word scans a run of non-space characters, starting with c, up to whitespace or a brace
+func (l *Lexer) word(c byte) Token {
+	var s strings.Builder
+
+	s.WriteByte(c)
+	for {
+		c, err := l.r.ReadByte()
+		if err != nil {
+			break
+		}
+
+		if strings.IndexByte(" \t\r\n{}\"", c) >= 0 {
+			_ = l.r.UnreadByte()
+			break
+		}
+		s.WriteByte(c)
+	}
+	return Token{Kind: Word, Line: l.line, Text: s.String()}
+}
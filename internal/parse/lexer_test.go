@@ -0,0 +1,79 @@
+package parse
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLexer(t *testing.T) {
+	Convey("Testing Lexer.Next()", t, func() {
+		tests := []struct {
+			errs string
+			exp  []string
+			in   string
+			name string
+		}{
+			{
+				name: "a tag node",
+				in:   "source malc0de {\n}",
+				exp:  []string{`1:word:"source"`, `1:word:"malc0de"`, `1:'{':"{"`, `1:newline:""`, `2:'}':"}"`, `2:EOF:""`},
+			},
+			{
+				name: "a quoted value containing braces",
+				in:   `description "{braces} and \"quotes\""`,
+				exp:  []string{`1:word:"description"`, `1:quoted string:"{braces} and \"quotes\""`, `1:EOF:""`},
+			},
+			{
+				name: "a multi-line quoted value",
+				in:   "description \"line one\nline two\"\nurl http://x.com/a/b",
+				exp:  []string{`1:word:"description"`, `1:quoted string:"line one\nline two"`, `2:newline:""`, `3:word:"url"`, `3:word:"http://x.com/a/b"`, `3:EOF:""`},
+			},
+			{
+				name: "a multi-line comment",
+				in:   "/* Warning:\n do not remove */ }",
+				exp:  []string{`1:comment:"Warning:\n do not remove"`, `2:'}':"}"`, `2:EOF:""`},
+			},
+			{
+				name: "an unterminated quoted string",
+				in:   `prefix "zone`,
+				exp:  []string{`1:word:"prefix"`, `1:quoted string:"zone"`, `1:EOF:""`},
+				errs: "line 1: unterminated quoted string",
+			},
+			{
+				name: "an unterminated comment",
+				in:   `/* comment`,
+				exp:  []string{`1:comment:"comment"`, `1:EOF:""`},
+				errs: "line 1: unterminated comment",
+			},
+		}
+
+		for _, tt := range tests {
+			Convey("with "+tt.name, func() {
+				var (
+					act []string
+					l   = NewLexer(strings.NewReader(tt.in))
+				)
+
+				for {
+					tok := l.Next()
+					act = append(act, tok.String())
+					if tok.Kind == EOF {
+						break
+					}
+				}
+
+				So(act, ShouldResemble, tt.exp)
+				So(l.Errors().Error(), ShouldEqual, tt.errs)
+			})
+		}
+	})
+}
+
+func TestKindString(t *testing.T) {
+	Convey("Testing Kind.String()", t, func() {
+		So(Word.String(), ShouldEqual, "word")
+		So(Kind(99).String(), ShouldEqual, "Kind(99)")
+	})
+}
@@ -0,0 +1,265 @@
+package parse
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Error is a syntax error at a given line
+type Error struct {
+	Line int
+	Msg  string
+}
+
+// ErrorList is a list of syntax errors
+type ErrorList []*Error
+
+// Node is an EdgeOS configuration AST node; a leaf has no Block, a node or tag node
+// has a Block of Children. Value holds the leaf value or tag name.
+type Node struct {
+	Block    bool
+	Children []*Node
+	Comments []string
+	Line     int
+	Name     string
+	Quoted   bool
+	Value    string
+}
+
+// parser is a recursive-descent parser for EdgeOS configurations
+type parser struct {
+	errs ErrorList
+	lex  *Lexer
+	peek *Token
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Msg)
+}
+
+func (e *ErrorList) add(line int, f string, args ...interface{}) {
+	*e = append(*e, &Error{Line: line, Msg: fmt.Sprintf(f, args...)})
+}
+
+// Err returns nil if the list is empty, otherwise the list as an error
+func (e ErrorList) Err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+func (e ErrorList) Error() string {
+	s := make([]string, len(e))
+	for i, err := range e {
+		s[i] = err.Error()
+	}
+	return strings.Join(s, "\n")
+}
+
+// Parse reads an EdgeOS configuration and returns its root Node; syntax errors are
+// collected and returned as an ErrorList alongside a best effort tree
+func Parse(r io.Reader) (*Node, error) {
+	p := &parser{lex: NewLexer(r)}
+	root := &Node{Block: true, Line: 1}
+	root.Children = p.body(true)
+
+	errs := append(p.lex.Errors(), p.errs...)
+	sort.SliceStable(errs, func(i, j int) bool { return errs[i].Line < errs[j].Line })
+	return root, errs.Err()
+}
+
+// body parses statements until a closing brace, or EOF at the top level
+func (p *parser) body(top bool) (nodes []*Node) {
+	var comments []string
+
+	for {
+		t := p.next()
+		switch t.Kind {
+		case EOF:
+			return trailing(nodes, comments)
+		case NewLine:
+			continue
+		case Comment:
+			comments = append(comments, t.Text)
+		case RBrace:
+			if top {
+				p.errs.add(t.Line, "unbalanced braces: unexpected closing brace")
+				continue
+			}
+			p.unread(t)
+			return trailing(nodes, comments)
+		case LBrace:
+			p.errs.add(t.Line, "unexpected '{' without a node name")
+			p.skipBlock(t)
+		case String, Word:
+			n := p.statement(t)
+			n.Comments, comments = comments, nil
+			nodes = append(nodes, n)
+		}
+	}
+}
+
+// trailing keeps comments that follow the last statement of a body as a nameless node
+func trailing(nodes []*Node, comments []string) []*Node {
+	if len(comments) > 0 {
+		nodes = append(nodes, &Node{Comments: comments})
+	}
+	return nodes
+}
+
+func (p *parser) next() Token {
+	if p.peek != nil {
+		t := *p.peek
+		p.peek = nil
+		return t
+	}
+	return p.lex.Next()
+}
+
+// skipBlock discards a block's contents after a syntax error
+func (p *parser) skipBlock(open Token) {
+	p.body(false)
+	if t := p.next(); t.Kind != RBrace {
+		p.errs.add(open.Line, "unbalanced braces: node is never closed")
+	}
+}
+
+// statement parses a leaf, node or tag node starting with the name token t
+func (p *parser) statement(t Token) *Node {
+	n := &Node{Line: t.Line, Name: t.Text}
+
+	v := p.next()
+	switch v.Kind {
+	case String, Word:
+		n.Value, n.Quoted = v.Text, v.Kind == String
+		v = p.next()
+	}
+
+	switch v.Kind {
+	case LBrace:
+		n.Block = true
+		n.Children = p.body(false)
+		if c := p.next(); c.Kind != RBrace {
+			p.errs.add(n.Line, "unbalanced braces: node %q is never closed", n.Path())
+		}
+	case NewLine, EOF:
+	case RBrace:
+		p.unread(v)
+	default:
+		p.errs.add(v.Line, "unexpected %v %q after %q", v.Kind, v.Text, n.Path())
+		p.skipLine()
+	}
+	return n
+}
+
+// skipLine discards tokens up to the end of the line
+func (p *parser) skipLine() {
+	for {
+		switch t := p.next(); t.Kind {
+		case EOF, NewLine:
+			return
+		case LBrace:
+			p.skipBlock(t)
+		}
+	}
+}
+
+func (p *parser) unread(t Token) {
+	p.peek = &t
+}
+
+// Find returns the first Block node named name, searching depth first
+func (n *Node) Find(name string) *Node {
+	for _, c := range n.Children {
+		if c.Block && c.Name == name {
+			return c
+		}
+		if f := c.Find(name); f != nil {
+			return f
+		}
+	}
+	return nil
+}
+
+// Get returns the child nodes matching the path of names, e.g. Get("system", "ntp", "server")
+func (n *Node) Get(path ...string) (nodes []*Node) {
+	if len(path) == 0 {
+		return []*Node{n}
+	}
+	for _, c := range n.Children {
+		if c.Name == path[0] {
+			nodes = append(nodes, c.Get(path[1:]...)...)
+		}
+	}
+	return nodes
+}
+
+// Values returns the values of leaves and the names of tag nodes matching the path of names
+func (n *Node) Values(path ...string) (v []string) {
+	for _, c := range n.Get(path...) {
+		if !c.Block || c.Value != "" {
+			v = append(v, c.Value)
+		}
+	}
+	return v
+}
+
+// Path returns the node's name and value, e.g. "source malc0de"
+func (n *Node) Path() string {
+	if n.Value == "" {
+		return n.Name
+	}
+	return n.Name + " " + n.Value
+}
+
+// String serialises the Node back to config.boot syntax
+func (n *Node) String() string {
+	var b strings.Builder
+	if n.Name == "" && n.Block {
+		for _, c := range n.Children {
+			c.write(&b, 0)
+		}
+		return b.String()
+	}
+	n.write(&b, 0)
+	return b.String()
+}
+
+// quote returns s quoted when required by config.boot syntax
+func quote(s string, force bool) string {
+	if !force && s != "" && !strings.ContainsAny(s, " \t\r\n{}\"") {
+		return s
+	}
+	s = strings.Replace(s, `\`, `\\`, -1)
+	return `"` + strings.Replace(s, `"`, `\"`, -1) + `"`
+}
+
+func (n *Node) write(b *strings.Builder, depth int) {
+	indent := strings.Repeat("    ", depth)
+	for _, c := range n.Comments {
+		fmt.Fprintf(b, "%s/* %s */\n", indent, c)
+	}
+
+	if n.Name == "" {
+		return
+	}
+
+	b.WriteString(indent + n.Name)
+	if n.Value != "" || n.Quoted {
+		b.WriteString(" " + quote(n.Value, n.Quoted))
+	}
+
+	if !n.Block {
+		b.WriteString("\n")
+		return
+	}
+
+	b.WriteString(" {\n")
+	for _, c := range n.Children {
+		c.write(b, depth+1)
+	}
+	b.WriteString(indent + "}\n")
+}
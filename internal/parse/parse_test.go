@@ -0,0 +1,120 @@
+package parse
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestParse(t *testing.T) {
+	Convey("Testing Parse()", t, func() {
+		root, err := Parse(strings.NewReader(cfg))
+		So(err, ShouldBeNil)
+
+		Convey("Testing Find()", func() {
+			b := root.Find("blacklist")
+			So(b, ShouldNotBeNil)
+			So(b.Line, ShouldEqual, 4)
+			So(root.Find("nothere"), ShouldBeNil)
+		})
+
+		Convey("Testing Get() and Values()", func() {
+			So(root.Values("system", "ntp", "server"), ShouldResemble, []string{"0.ubnt.pool.ntp.org", "1.ubnt.pool.ntp.org"})
+			src := root.Find("blacklist").Get("domains", "source")
+			So(len(src), ShouldEqual, 2)
+			So(src[0].Path(), ShouldEqual, "source malc0de")
+			So(src[0].Values("description"), ShouldResemble, []string{"Zones {with} braces\nand a second line"})
+			So(src[1].Value, ShouldEqual, "my list")
+			So(src[1].Values("prefix"), ShouldResemble, []string{""})
+		})
+
+		Convey("Testing round trip serialisation", func() {
+			So(root.String(), ShouldEqual, cfg)
+
+			again, err := Parse(strings.NewReader(root.String()))
+			So(err, ShouldBeNil)
+			So(again, ShouldResemble, root)
+		})
+	})
+
+	Convey("Testing Parse() with syntax errors", t, func() {
+		tests := []struct {
+			exp  string
+			in   string
+			name string
+			out  string
+		}{
+			{
+				name: "an unclosed node",
+				in:   "blacklist {\n    domains {\n        include a.com\n}\n",
+				exp:  `line 1: unbalanced braces: node "blacklist" is never closed`,
+				out:  "blacklist {\n    domains {\n        include a.com\n    }\n}\n",
+			},
+			{
+				name: "a stray closing brace",
+				in:   "blacklist {\n}\n}\n",
+				exp:  "line 3: unbalanced braces: unexpected closing brace",
+				out:  "blacklist {\n}\n",
+			},
+			{
+				name: "a brace without a name",
+				in:   "{\n    include a.com\n}\nblacklist {\n}\n",
+				exp:  "line 1: unexpected '{' without a node name",
+				out:  "blacklist {\n}\n",
+			},
+			{
+				name: "too many words",
+				in:   "blacklist {\n    include a.com b.com\n}\n",
+				exp:  `line 2: unexpected word "b.com" after "include a.com"`,
+				out:  "blacklist {\n    include a.com\n}\n",
+			},
+		}
+
+		for _, tt := range tests {
+			Convey("with "+tt.name, func() {
+				root, err := Parse(strings.NewReader(tt.in))
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, tt.exp)
+				So(root.String(), ShouldEqual, tt.out)
+			})
+		}
+	})
+}
+
+const cfg = `service {
+    dns {
+        forwarding {
+            blacklist {
+                disabled false
+                dns-redirect-ip 0.0.0.0
+                domains {
+                    include adsrvr.org
+                    source malc0de {
+                        description "Zones {with} braces
+and a second line"
+                        prefix "zone "
+                        url http://malc0de.com/bl/ZONES
+                    }
+                    source "my list" {
+                        /* A local file */
+                        file /config/user-data/my.list
+                        prefix ""
+                    }
+                }
+                exclude "quoted.example.com"
+            }
+        }
+    }
+}
+system {
+    ntp {
+        server 0.ubnt.pool.ntp.org {
+        }
+        server 1.ubnt.pool.ntp.org {
+        }
+    }
+}
+/* Warning: Do not remove the following line. */
+/* === vyatta-config-version: "config-management@1:system@4" === */
+`
@@ -0,0 +1,226 @@
+// Package server is a forwarding DNS server that answers blacklisted names itself, for hosts
+// that don't run dnsmasq
+package server
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/britannic/blacklist/internal/dnsmasq"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// Server answers queries from its block set, a dnsmasq configuration of address=, server= and
+// local= entries, and forwards everything else to its upstream resolvers
+type Server struct {
+	Addr      string        // listen address, e.g. :53
+	Upstreams []string      // upstream resolvers, the port defaults to 53
+	Timeout   time.Duration // upstream query timeout, defaults to 2 seconds
+
+	conf atomic.Value // dnsmasq.Conf
+	mu   sync.Mutex
+	tcp  net.Listener
+	udp  net.PacketConn
+}
+
+// New returns a *Server listening on addr that forwards to upstreams, with an empty block set
+func New(addr string, upstreams ...string) *Server {
+	s := &Server{Addr: addr, Upstreams: upstreams}
+	s.conf.Store(make(dnsmasq.Conf))
+	return s
+}
+
+// Swap replaces the block set; queries being answered finish with the previous one
+func (s *Server) Swap(c dnsmasq.Conf) {
+	s.conf.Store(c)
+}
+
+// Start listens on Addr over UDP and TCP, sharing the port, and serves queries until Close
+func (s *Server) Start() error {
+	if len(s.Upstreams) == 0 {
+		return errors.New("no upstream resolvers")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	udp, err := net.ListenPacket("udp", s.Addr)
+	if err != nil {
+		return err
+	}
+	tcp, err := net.Listen("tcp", udp.LocalAddr().String())
+	if err != nil {
+		udp.Close()
+		return err
+	}
+	s.udp, s.tcp = udp, tcp
+
+	go s.serveUDP(udp)
+	go s.serveTCP(tcp)
+	return nil
+}
+
+// LocalAddr returns the address the server is listening on, or "" if it isn't
+func (s *Server) LocalAddr() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.udp == nil {
+		return ""
+	}
+	return s.udp.LocalAddr().String()
+}
+
+// Close stops the server
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.udp == nil {
+		return nil
+	}
+	err := s.udp.Close()
+	if e := s.tcp.Close(); err == nil {
+		err = e
+	}
+	s.udp, s.tcp = nil, nil
+	return err
+}
+
+func (s *Server) serveUDP(conn net.PacketConn) {
+	for {
+		b := make([]byte, 4096)
+		n, addr, err := conn.ReadFrom(b)
+		if err != nil {
+			return
+		}
+		go func() {
+			if r := s.answer(b[:n], "udp"); r != nil {
+				_, _ = conn.WriteTo(r, addr)
+			}
+		}()
+	}
+}
+
+func (s *Server) serveTCP(l net.Listener) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go s.serveConn(conn)
+	}
+}
+
+// serveConn answers the length prefixed queries on a TCP connection until the client closes it
+func (s *Server) serveConn(conn net.Conn) {
+	defer conn.Close()
+
+	for {
+		if err := conn.SetDeadline(time.Now().Add(10 * time.Second)); err != nil {
+			return
+		}
+		l := make([]byte, 2)
+		if _, err := io.ReadFull(conn, l); err != nil {
+			return
+		}
+		q := make([]byte, binary.BigEndian.Uint16(l))
+		if _, err := io.ReadFull(conn, q); err != nil {
+			return
+		}
+
+		r := s.answer(q, "tcp")
+		if r == nil {
+			return
+		}
+		if _, err := conn.Write(append([]byte{byte(len(r) >> 8), byte(len(r))}, r...)); err != nil {
+			return
+		}
+	}
+}
+
+// answer returns the packed response to a packed query, or nil if it can't be parsed
+func (s *Server) answer(q []byte, network string) []byte {
+	var m dnsmessage.Message
+	if err := m.Unpack(q); err != nil || m.Response {
+		return nil
+	}
+	if len(m.Questions) != 1 {
+		return reply(m, dnsmessage.RCodeFormatError)
+	}
+
+	h, ok := s.conf.Load().(dnsmasq.Conf).Match(m.Questions[0].Name.String())
+	switch {
+	case !ok, h.Server && h.IP == "#":
+		return s.forward(m, q, network, s.Upstreams)
+	case h.Server && h.IP != "":
+		return s.forward(m, q, network, []string{strings.Replace(h.IP, "#", ":", 1)})
+	}
+	return block(m, h.IP)
+}
+
+// block answers a blocked name with its redirect address, or NXDOMAIN if it hasn't got one;
+// the unspecified address blocks both A and AAAA queries, as it does in dnsmasq
+func block(m dnsmessage.Message, redirect string) []byte {
+	ip := net.ParseIP(redirect)
+	if ip == nil {
+		return reply(m, dnsmessage.RCodeNameError)
+	}
+
+	q := m.Questions[0]
+	hdr := dnsmessage.ResourceHeader{Name: q.Name, Type: q.Type, Class: q.Class, TTL: 60}
+	switch v4 := ip.To4(); {
+	case q.Type == dnsmessage.TypeA && v4 != nil:
+		r := &dnsmessage.AResource{}
+		copy(r.A[:], v4)
+		m.Answers = []dnsmessage.Resource{{Header: hdr, Body: r}}
+	case q.Type == dnsmessage.TypeAAAA && (v4 == nil || ip.IsUnspecified()):
+		r := &dnsmessage.AAAAResource{}
+		if v4 == nil {
+			copy(r.AAAA[:], ip)
+		}
+		m.Answers = []dnsmessage.Resource{{Header: hdr, Body: r}}
+	}
+	return reply(m, dnsmessage.RCodeSuccess)
+}
+
+// forward relays a query over UDP to the first of the upstream resolvers to answer it; a
+// truncated response is retried over TCP for a TCP client and relayed for a UDP client to retry
+func (s *Server) forward(m dnsmessage.Message, q []byte, network string, upstreams []string) []byte {
+	for _, u := range upstreams {
+		r, err := (&dnsmasq.Resolver{Addr: u, Net: "udp", Timeout: s.Timeout}).Exchange(q)
+		if err == nil && network == "tcp" && truncated(r) {
+			r, err = (&dnsmasq.Resolver{Addr: u, Net: "tcp", Timeout: s.Timeout}).Exchange(q)
+		}
+		if err == nil {
+			return r
+		}
+	}
+	return reply(m, dnsmessage.RCodeServerFailure)
+}
+
+// truncated returns true if a packed response has the TC bit set
+func truncated(r []byte) bool {
+	return len(r) > 2 && r[2]&0x02 != 0
+}
+
+// reply packs m as a response with the rcode
+func reply(m dnsmessage.Message, rcode dnsmessage.RCode) []byte {
+	m.Response = true
+	m.RecursionAvailable = true
+	m.RCode = rcode
+	m.Authorities = nil
+	m.Additionals = nil
+
+	b, err := m.Pack()
+	if err != nil {
+		return nil
+	}
+	return b
+}
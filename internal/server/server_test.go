@@ -0,0 +1,171 @@
+package server
+
+import (
+	"net"
+	"testing"
+
+	"github.com/britannic/blacklist/internal/dnsmasq"
+	. "github.com/smartystreets/goconvey/convey"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// upstream starts a resolver answering every A query with ip and returns its address
+func upstream(ip string) (string, func()) {
+	p, err := net.ListenPacket("udp", "127.0.0.1:0")
+	So(err, ShouldBeNil)
+
+	go func() {
+		b := make([]byte, 512)
+		for {
+			n, addr, err := p.ReadFrom(b)
+			if err != nil {
+				return
+			}
+			var m dnsmessage.Message
+			if m.Unpack(b[:n]) != nil {
+				continue
+			}
+			a := &dnsmessage.AResource{}
+			copy(a.A[:], net.ParseIP(ip).To4())
+			m.Response = true
+			m.Answers = []dnsmessage.Resource{{
+				Header: dnsmessage.ResourceHeader{Name: m.Questions[0].Name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET, TTL: 60},
+				Body:   a,
+			}}
+			r, _ := m.Pack()
+			_, _ = p.WriteTo(r, addr)
+		}
+	}()
+	return p.LocalAddr().String(), func() { p.Close() }
+}
+
+func TestServer(t *testing.T) {
+	Convey("Testing the DNS server", t, func() {
+		up, stop := upstream("93.184.216.34")
+		defer stop()
+		school, stopSchool := upstream("10.0.0.53")
+		defer stopSchool()
+
+		s := New("127.0.0.1:0", up)
+		So(s.Start(), ShouldBeNil)
+		defer s.Close()
+
+		s.Swap(dnsmasq.Conf{
+			"ads.com":        {IP: "0.0.0.0"},
+			"ok.ads.com":     {IP: "#", Server: true},
+			"redirected.com": {IP: "192.168.168.1"},
+			"school.edu":     {IP: school, Server: true},
+			"tracker.net":    {},
+			"nx.org":         {Server: true},
+		})
+
+		tests := []struct {
+			name string
+			exp  string
+		}{
+			{name: "ads.com", exp: "0.0.0.0"},
+			{name: "www.ads.com", exp: "0.0.0.0"},
+			{name: "ok.ads.com", exp: "93.184.216.34"},
+			{name: "redirected.com", exp: "192.168.168.1"},
+			{name: "tracker.net", exp: "NXDOMAIN"},
+			{name: "nx.org", exp: "NXDOMAIN"},
+			{name: "www.school.edu", exp: "10.0.0.53"},
+			{name: "example.org", exp: "93.184.216.34"},
+		}
+
+		for _, network := range []string{"udp", "tcp"} {
+			r := &dnsmasq.Resolver{Addr: s.LocalAddr(), Net: network}
+			for _, tt := range tests {
+				Convey("over "+network+" for "+tt.name, func() {
+					a, err := r.Lookup(tt.name)
+					So(err, ShouldBeNil)
+					So(a.String(), ShouldEqual, tt.exp)
+				})
+			}
+		}
+
+		Convey("The block set is hot swapped", func() {
+			r := &dnsmasq.Resolver{Addr: s.LocalAddr()}
+			s.Swap(dnsmasq.Conf{"example.org": {IP: "0.0.0.0"}})
+
+			a, err := r.Lookup("example.org")
+			So(err, ShouldBeNil)
+			So(a.String(), ShouldEqual, "0.0.0.0")
+
+			a, err = r.Lookup("ads.com")
+			So(err, ShouldBeNil)
+			So(a.String(), ShouldEqual, "93.184.216.34")
+		})
+
+		Convey("Unreachable upstreams are a server failure", func() {
+			stop()
+			_, err := (&dnsmasq.Resolver{Addr: s.LocalAddr()}).Lookup("example.org")
+			So(err.Error(), ShouldEqual, "example.org: RCodeServerFailure")
+		})
+	})
+
+	Convey("Testing a server without upstreams", t, func() {
+		So(New("127.0.0.1:0").Start().Error(), ShouldEqual, "no upstream resolvers")
+		So(New("127.0.0.1:0").Close(), ShouldBeNil)
+		So(New("127.0.0.1:0").LocalAddr(), ShouldBeEmpty)
+	})
+}
+
+func TestBlock(t *testing.T) {
+	Convey("Testing block()", t, func() {
+		query := func(t dnsmessage.Type) dnsmessage.Message {
+			return dnsmessage.Message{Questions: []dnsmessage.Question{{Name: dnsmessage.MustNewName("ads.com."), Type: t, Class: dnsmessage.ClassINET}}}
+		}
+
+		tests := []struct {
+			name     string
+			qtype    dnsmessage.Type
+			redirect string
+			exp      string
+		}{
+			{name: "A for the unspecified address", qtype: dnsmessage.TypeA, redirect: "0.0.0.0", exp: "A 0.0.0.0"},
+			{name: "AAAA for the unspecified address", qtype: dnsmessage.TypeAAAA, redirect: "0.0.0.0", exp: "AAAA ::"},
+			{name: "AAAA for an IPv4 redirect", qtype: dnsmessage.TypeAAAA, redirect: "192.168.168.1", exp: ""},
+			{name: "AAAA for an IPv6 redirect", qtype: dnsmessage.TypeAAAA, redirect: "fd00::1", exp: "AAAA fd00::1"},
+			{name: "MX", qtype: dnsmessage.TypeMX, redirect: "0.0.0.0", exp: ""},
+			{name: "no redirect", qtype: dnsmessage.TypeA, redirect: "", exp: "RCodeNameError"},
+		}
+
+		for _, tt := range tests {
+			Convey("with "+tt.name, func() {
+				var m dnsmessage.Message
+				So(m.Unpack(block(query(tt.qtype), tt.redirect)), ShouldBeNil)
+				So(m.Response, ShouldBeTrue)
+
+				act := ""
+				switch {
+				case m.RCode != dnsmessage.RCodeSuccess:
+					act = m.RCode.String()
+				case len(m.Answers) == 1:
+					switch r := m.Answers[0].Body.(type) {
+					case *dnsmessage.AResource:
+						act = "A " + net.IP(r.A[:]).String()
+					case *dnsmessage.AAAAResource:
+						act = "AAAA " + net.IP(r.AAAA[:]).String()
+					}
+				}
+				So(act, ShouldEqual, tt.exp)
+			})
+		}
+	})
+}
+
+func TestTruncated(t *testing.T) {
+	Convey("Testing truncated()", t, func() {
+		m := dnsmessage.Message{Header: dnsmessage.Header{Response: true, Truncated: true}}
+		b, err := m.Pack()
+		So(err, ShouldBeNil)
+		So(truncated(b), ShouldBeTrue)
+
+		m.Truncated = false
+		b, err = m.Pack()
+		So(err, ShouldBeNil)
+		So(truncated(b), ShouldBeFalse)
+		So(truncated(nil), ShouldBeFalse)
+	})
+}
@@ -0,0 +1,23 @@
+#!/bin/sh
+# Stands in for /opt/vyatta/sbin/my_cli_shell in tests by echoing the
+# configuration session it receives; the commit fails if asked to set "fail",
+# so the session is discarded and it exits 1
+while read -r line; do
+	case "$line" in
+	*"'fail'"*)
+		echo "$line"
+		failed=1
+		;;
+	"if commit; then"*)
+		echo commit
+		if [ -n "$failed" ]; then
+			echo "Commit failed"
+			echo "exit discard"
+			exit 1
+		fi
+		echo save
+		echo exit
+		;;
+	*) echo "$line" ;;
+	esac
+done
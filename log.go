@@ -29,6 +29,7 @@ var (
 	logInfof   = log.Infof
 	logNoticef = log.Noticef
 	logPrintf  = logInfof
+	logWarnf   = log.Warningf
 )
 
 // inTerminal returns true if the current terminal is interactive
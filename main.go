@@ -3,8 +3,14 @@ package main
 import (
 	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
 
+	"github.com/britannic/blacklist/internal/dnsmasq"
 	e "github.com/britannic/blacklist/internal/edgeos"
+	"github.com/britannic/blacklist/internal/server"
 )
 
 var (
@@ -16,26 +22,20 @@ var (
 	version      = "UNKNOWN"
 	// ----------------------------
 
-	exitCmd      = os.Exit
-	initEnvirons = initEnv
-	prog         = basename(os.Args[0])
-	prefix       = fmt.Sprintf("%s: ", prog)
-	defCfgFile   = "/config/user-data/blacklist.failover.cfg"
+	exitCmd        = os.Exit
+	sleep          = time.Sleep
+	initEnvirons   = initEnv
+	prog           = basename(os.Args[0])
+	prefix         = fmt.Sprintf("%s: ", prog)
+	defBundleKey   = "/config/user-data/blacklist.bundle.key"
+	defCatalogFile = "/config/user-data/blacklist.catalog.json"
+	defCfgFile     = "/config/user-data/blacklist.failover.cfg"
+	defHitsFile    = "/config/user-data/blacklist.hits.json"
+	defHostsDir    = "/etc/dnsmasq.hosts"
+	defStateFile   = "/config/user-data/blacklist.state.json"
 )
 
 func main() {
-	objex := []e.IFace{
-		e.PreRObj,
-		e.PreDObj,
-		e.PreHObj,
-		e.ExRtObj,
-		e.ExDmObj,
-		e.ExHtObj,
-		e.FileObj,
-		e.URLdObj,
-		e.URLhObj,
-	}
-
 	if os.Geteuid() != 0 {
 		fmt.Printf("%s must be run as sudo\n", prog)
 		logErrorf("%s must be run as sudo", prog)
@@ -51,12 +51,44 @@ func main() {
 	c.Debug(fmt.Sprintf("Dumping env variables: %v", c))
 	logNoticef("%v", "Starting blacklist update...")
 
-	if !e.ChkWeb("www.google.com", 443) {
-		logFatalf("%s", "No internet access, aborting blacklist update!")
+	if !c.Bundled() {
+		if err = c.Connected(); err != nil {
+			logErrorf("%v, so url sources keep their previous blacklist entries", err)
+		}
+	}
+
+	refresh(c)
+
+	if c.Overlap {
+		fmt.Print(c.Overlaps())
+	}
+
+	if c.Changed() {
+		reloadDNS(c)
+	} else {
+		logNoticef("%v", "No blacklist files changed, so dnsmasq wasn't reloaded")
+	}
+
+	logNoticef("%v", "Blacklist update completed......")
+}
+
+// refresh removes stale files, processes the sources, writes the dnsmasq configuration files
+// and logs the run report
+func refresh(c *e.Config) {
+	objex := []e.IFace{
+		e.PreRObj,
+		e.PreDObj,
+		e.PreHObj,
+		e.ExRtObj,
+		e.ExDmObj,
+		e.ExHtObj,
+		e.FileObj,
+		e.URLdObj,
+		e.URLhObj,
 	}
 
 	logInfo("Checking for stale blacklists...")
-	if err = removeStaleFiles(c); err != nil {
+	if err := removeStaleFiles(c); err != nil {
 		logFatalf("%v", err.Error())
 	}
 
@@ -66,18 +98,30 @@ func main() {
 		if err := processObjects(c, objex); err != nil {
 			logErrorf("%v", err.Error())
 		}
+		if err := c.Allowlist(); err != nil {
+			logErrorf("%v", err.Error())
+		}
+		if err := c.SafeSearch(); err != nil {
+			logErrorf("%v", err.Error())
+		}
 	}
 
-	dropped, extracted, kept := c.GetTotalStats()
-	if kept+dropped != 0 {
+	dropped, extracted, invalid, kept := c.GetTotalStats()
+	if kept+dropped+invalid != 0 {
 		c.Log.Noticef("Total entries found: %d", extracted)
 		c.Log.Noticef("Total entries extracted %d", kept)
 		c.Log.Noticef("Total entries dropped %d", dropped)
+		c.Log.Noticef("Total entries invalid %d", invalid)
 	}
 
-	reloadDNS(c)
-
-	logNoticef("%v", "Blacklist update completed......")
+	for _, r := range c.Report() {
+		if r.Tripped != "" {
+			c.Log.Warningf("Run report: %s kept its previous %d entries, %s", r.Name, r.Previous, r.Tripped)
+		}
+		for _, x := range r.Conflicts {
+			c.Log.Warningf("Run report: %s: %s", r.Name, x)
+		}
+	}
 }
 
 // basename removes directory components and file extensions.
@@ -109,6 +153,25 @@ func initEnv() (c *e.Config, err error) {
 	o := getOpts()
 	o.setArgs()
 	c = o.initEdgeOS()
+	if *o.Validate {
+		validate(c, o)
+	}
+	if *o.Verify {
+		verify(c, o)
+	}
+	if *o.Effectv {
+		effective(o)
+	}
+	if *o.Top > 0 {
+		top(c, o)
+	}
+	if *o.Allow != "" {
+		allow(c, o)
+	}
+	if *o.Status {
+		status(c)
+	}
+	configure(c, o)
 	if *o.File == "" {
 		if c, err = loadConfig(c, o); err != nil {
 			if _, err = os.Stat(defCfgFile); !os.IsNotExist(err) && *o.Safe {
@@ -117,7 +180,19 @@ func initEnv() (c *e.Config, err error) {
 		}
 	}
 
-	return loadConfig(c, o)
+	if c, err = loadConfig(c, o); err != nil {
+		return c, err
+	}
+	if *o.Export != "" {
+		export(c, o)
+	}
+	if *o.Import != "" {
+		importBundle(c, o)
+	}
+	if *o.Serve {
+		serve(c, o)
+	}
+	return c, err
 
 }
 
@@ -141,18 +216,285 @@ func loadConfig(c *e.Config, o *opts) (*e.Config, error) {
 // processObjects processes local sources, downloads Internet sources and creates
 // dnsmasq configuration files
 func processObjects(c *e.Config, objects []e.IFace) error {
+	var cts []e.Contenter
 	for _, o := range objects {
 		ct, err := c.NewContent(o)
 		if err != nil {
 			return err
 		}
-		if err = c.ProcessContent(ct); err != nil {
-			return err
+		cts = append(cts, ct)
+	}
+	return c.ProcessContent(cts...)
+}
+
+// configure commits any blacklist configuration changes set on the command line and exits
+func configure(c *e.Config, o *opts) {
+	cmds, err := o.changes()
+	switch {
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "%s%v\n", prefix, err)
+		exitCmd(1)
+		return
+	case len(cmds) == 0:
+		return
+	}
+
+	b, err := (&e.CFGcli{Config: c}).Commit(cmds)
+	fmt.Print(string(b))
+	if err != nil {
+		logErrorf("configuration commit failed: %v", err)
+		exitCmd(1)
+		return
+	}
+	exitCmd(0)
+}
+
+// validate checks the blacklist configuration, displays any problems found and exits
+func validate(c *e.Config, o *opts) {
+	d := c.Validate(o.getCFG(c))
+	if len(d) > 0 {
+		fmt.Println(d.String())
+	}
+	fmt.Printf("%s: %d error(s), %d warning(s)\n", prog, d.Errors(), d.Warnings())
+	if d.Errors() > 0 {
+		exitCmd(1)
+		return
+	}
+	exitCmd(0)
+}
+
+// verify probes the blacklist files on the -resolver, displays the entries that aren't blocked and exits
+func verify(c *e.Config, o *opts) {
+	r := &dnsmasq.Resolver{Addr: *o.Resolver, Net: "udp"}
+	if *o.TCP {
+		r.Net = "tcp"
+	}
+
+	p, err := c.Probe(r, *o.Samples)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s%v\n", prefix, err)
+		exitCmd(1)
+		return
+	}
+
+	fmt.Print(p.String())
+	fmt.Printf("%s: %d of %d sampled entries aren't blocked by %s\n", prog, p.Missed(), p.Sampled(), *o.Resolver)
+	if p.Missed() > 0 {
+		exitCmd(1)
+		return
+	}
+	exitCmd(0)
+}
+
+// effective displays every domain that dnsmasq blocks, what it answers and the file blocking it, then exits
+func effective(o *opts) {
+	c, err := dnsmasq.Load(*o.DNSconf)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s%v\n", prefix, err)
+		exitCmd(1)
+		return
+	}
+
+	b := c.Blocklist()
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "domain\tanswer\tfile")
+	for _, k := range b.Keys() {
+		a := b[k].IP
+		if a == "" {
+			a = "NXDOMAIN"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", k, a, b[k].File)
+	}
+	_ = w.Flush()
+
+	fmt.Printf("%s: dnsmasq blocks %d domains\n", prog, len(b))
+	exitCmd(0)
+}
+
+// allow stops blocking a domain for the -for duration, reloads dnsmasq if any blacklist files
+// blocked it, then exits
+func allow(c *e.Config, o *opts) {
+	f, err := c.Allow(*o.Allow, *o.For)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s%v\n", prefix, err)
+		exitCmd(1)
+		return
+	}
+
+	fmt.Printf("%s: allowing %s for %v\n", prog, *o.Allow, *o.For)
+	if len(f) > 0 {
+		reloadDNS(c)
+	}
+	exitCmd(0)
+}
+
+// status displays each source's entries from the last run and the temporary exceptions, then exits
+func status(c *e.Config) {
+	fmt.Print(c.Status())
+	exitCmd(0)
+}
+
+// top counts the blocked queries added to the -query-log since it was last read, displays each
+// source's hits and the most blocked domains and clients, then exits
+func top(c *e.Config, o *opts) {
+	s, err := c.Ingest(*o.QueryLog)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s%v\n", prefix, err)
+		exitCmd(1)
+		return
+	}
+
+	fmt.Print(s.Top(*o.Top))
+	exitCmd(0)
+}
+
+// export downloads every url source into a bundle signed with the -bundle-key, then exits
+func export(c *e.Config, o *opts) {
+	f, err := os.Create(*o.Export)
+	if err == nil {
+		var b *e.Bundle
+		if b, err = c.Export(f, *o.BdlKey); err == nil {
+			fmt.Print(b.String())
+			fmt.Printf("%s: bundled %d sources into %s, check it with the public key %s.pub\n", prog, len(b.Sources), *o.Export, *o.BdlKey)
 		}
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s%v\n", prefix, err)
+		exitCmd(1)
+		return
 	}
+	exitCmd(0)
+}
+
+// importBundle has the url sources read from the -import-bundle instead of being downloaded,
+// exiting if it isn't signed with the -bundle-key or is stale
+func importBundle(c *e.Config, o *opts) {
+	if err := loadBundle(c, o); err != nil {
+		fmt.Fprintf(os.Stderr, "%s%v\n", prefix, err)
+		exitCmd(1)
+	}
+}
+
+// loadBundle imports the -import-bundle bundle
+func loadBundle(c *e.Config, o *opts) error {
+	f, err := os.Open(*o.Import)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	b, err := c.Import(f, *o.BdlKey+".pub", *o.BdlAge)
+	if err != nil {
+		return err
+	}
+	logNoticef("Importing %d sources from the bundle created %s", len(b.Sources), b.Created.Local().Format(time.RFC3339))
 	return nil
 }
 
+// reconfigure loads the configuration afresh for serve's next refresh, importing the bundle
+// again if there is one; unlike loadConfig, it returns an error rather than removing the
+// blacklist files and exiting, so the server keeps answering from its current blacklist
+func reconfigure(o *opts) (*e.Config, error) {
+	c := o.initEdgeOS()
+	if err := c.Blacklist(o.getCFG(c)); err != nil {
+		if err = c.Blacklist(o.getCFG(c)); err != nil {
+			return nil, err
+		}
+	}
+	if *o.Import != "" {
+		if err := loadBundle(c, o); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// serve updates the blacklist and answers DNS queries from it, forwarding everything else to
+// the -upstream resolvers, then updates it again every -refresh without dropping queries; a
+// refresh that can't load the configuration keeps serving the current blacklist
+func serve(c *e.Config, o *opts) {
+	var up []string
+	for _, u := range strings.Split(*o.Upstream, ",") {
+		if u = strings.TrimSpace(u); u != "" {
+			up = append(up, u)
+		}
+	}
+	s := server.New(*o.Listen, up...)
+
+	var n int
+	for first := true; ; first = false {
+		if !first {
+			sleep(*o.Refresh)
+			r, err := reconfigure(o)
+			if err != nil {
+				logErrorf("Unable to refresh the blacklist, so it keeps serving %d blacklisted domains: %v", n, err)
+				continue
+			}
+			c = r
+		}
+
+		if !c.Bundled() {
+			if err := c.Connected(); err != nil {
+				logErrorf("%v, so url sources keep their previous blacklist entries", err)
+			}
+		}
+
+		refresh(c)
+		b, err := blockSet(c)
+		if err != nil {
+			logErrorf("%v", err.Error())
+		}
+		if b != nil {
+			s.Swap(b)
+			n = len(b)
+		}
+
+		if first {
+			if err = s.Start(); err != nil {
+				fmt.Fprintf(os.Stderr, "%s-serve: %v\n", prefix, err)
+				exitCmd(1)
+				return
+			}
+			logNoticef("Answering DNS queries on %s, forwarding to %s", s.LocalAddr(), strings.Join(up, ", "))
+		}
+		logNoticef("Serving %d blacklisted domains", n)
+	}
+}
+
+// blockSet loads the blacklist files written by refresh, including those in hosts format; it warns
+// that safe search's cname= and host-record= lines aren't served
+func blockSet(c *e.Config) (dnsmasq.Conf, error) {
+	f, err := filepath.Glob(fmt.Sprintf(c.FnFmt, c.Dir, "*", "*", c.Ext))
+	if err != nil {
+		return nil, err
+	}
+	for _, x := range f {
+		if x == c.SafeSearchFile() {
+			logWarnf("-serve doesn't answer the cname= and host-record= lines in %s, so safe search is only enforced for redirects to an IP address", x)
+		}
+	}
+	b, err := dnsmasq.Load(f...)
+	if err != nil || c.HostsDir == "" {
+		return b, err
+	}
+
+	if f, err = filepath.Glob(fmt.Sprintf(c.FnFmt, c.HostsDir, "*", "*", "hosts")); err != nil {
+		return nil, err
+	}
+	h, err := dnsmasq.LoadHosts(f...)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range h {
+		b[k] = v
+	}
+	return b, nil
+}
+
 // reloadDNS reloads the latest processed dnsmasq configuration files
 func reloadDNS(c *e.Config) {
 	if b, err := c.ReloadDNS(); err != nil {
@@ -164,7 +506,7 @@ func reloadDNS(c *e.Config) {
 
 // removeStaleFiles deletes redundant files
 func removeStaleFiles(c *e.Config) error {
-	if err := c.GetAll().Files().Remove(); err != nil {
+	if err := c.Files().Remove(); err != nil {
 		return fmt.Errorf("problem removing stale files: %v", err.Error())
 	}
 	return nil
@@ -10,6 +10,7 @@ import (
 	"path"
 	"path/filepath"
 	"testing"
+	"time"
 
 	e "github.com/britannic/blacklist/internal/edgeos"
 	"github.com/britannic/mflag"
@@ -434,6 +435,273 @@ func TestRemoveStaleFiles(t *testing.T) {
 	})
 }
 
+func TestValidate(t *testing.T) {
+	Convey("Testing validate()", t, func() {
+		var act int
+		exitCmd = func(i int) { act = i }
+
+		tests := []struct {
+			exp  int
+			file string
+			name string
+		}{
+			{name: "valid configuration", file: "internal/testdata/config.erx.boot", exp: 0},
+			{name: "invalid configuration", file: "internal/testdata/config.invalid.boot", exp: 1},
+		}
+
+		for _, tt := range tests {
+			Convey("with "+tt.name, func() {
+				o := getOpts()
+				*o.File = tt.file
+				act = -1
+				validate(o.initEdgeOS(), o)
+				So(act, ShouldEqual, tt.exp)
+			})
+		}
+	})
+}
+
+func TestVerify(t *testing.T) {
+	Convey("Testing verify()", t, func() {
+		var act int
+		exitCmd = func(i int) { act = i }
+
+		dir, err := ioutil.TempDir("/tmp", "testBlacklist")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		o := getOpts()
+		*o.Resolver, *o.TCP = "127.0.0.1:1", true
+		c := o.initEdgeOS()
+		c.SetOpt(e.Dir(dir))
+
+		act = -1
+		verify(c, o)
+		So(act, ShouldEqual, 0)
+
+		So(ioutil.WriteFile(dir+"/domains.malc0de.blacklist.conf", []byte("address=/bad.com/0.0.0.0\n"), 0644), ShouldBeNil)
+		act = -1
+		verify(c, o)
+		So(act, ShouldEqual, 1)
+	})
+}
+
+func TestEffective(t *testing.T) {
+	Convey("Testing effective()", t, func() {
+		var act int
+		exitCmd = func(i int) { act = i }
+
+		dir, err := ioutil.TempDir("/tmp", "testBlacklist")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		o := getOpts()
+		*o.DNSconf = dir + "/dnsmasq.conf"
+
+		act = -1
+		effective(o)
+		So(act, ShouldEqual, 1)
+
+		So(ioutil.WriteFile(dir+"/domains.malc0de.blacklist.conf", []byte("address=/bad.com/0.0.0.0\n"), 0644), ShouldBeNil)
+		So(ioutil.WriteFile(*o.DNSconf, []byte("conf-dir="+dir+",*.blacklist.conf\nlocal=/nx.com/\n"), 0644), ShouldBeNil)
+		act = -1
+		effective(o)
+		So(act, ShouldEqual, 0)
+	})
+}
+
+func TestAllow(t *testing.T) {
+	Convey("Testing allow() and status()", t, func() {
+		var act int
+		exitCmd = func(i int) { act = i }
+
+		dir, err := ioutil.TempDir("/tmp", "testBlacklist")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		o := getOpts()
+		*o.DNSdir, *o.DNStmp, *o.Allow = dir, dir, "bad.com"
+		c := o.initEdgeOS()
+
+		act = -1
+		allow(c, o)
+		So(act, ShouldEqual, 0)
+
+		act = -1
+		status(o.initEdgeOS())
+		So(act, ShouldEqual, 0)
+
+		*o.Allow = "10.0.0.1"
+		act = -1
+		allow(c, o)
+		So(act, ShouldEqual, 1)
+	})
+}
+
+func TestTop(t *testing.T) {
+	Convey("Testing top()", t, func() {
+		var act int
+		exitCmd = func(i int) { act = i }
+
+		dir, err := ioutil.TempDir("/tmp", "testBlacklist")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		o := getOpts()
+		*o.DNSdir, *o.DNStmp, *o.QueryLog, *o.Top = dir, dir, dir+"/messages", 5
+		c := o.initEdgeOS()
+
+		act = -1
+		top(c, o)
+		So(act, ShouldEqual, 1)
+
+		So(ioutil.WriteFile(dir+"/domains.malc0de.blacklist.conf", []byte("address=/bad.com/0.0.0.0\n"), 0644), ShouldBeNil)
+		So(ioutil.WriteFile(*o.QueryLog, []byte("Oct 19 10:00:00 ubnt dnsmasq[812]: config bad.com is 0.0.0.0\n"), 0644), ShouldBeNil)
+		act = -1
+		top(c, o)
+		So(act, ShouldEqual, 0)
+		_, err = os.Stat(dir + "/blacklist.hits.json")
+		So(err, ShouldBeNil)
+	})
+}
+
+func TestBundle(t *testing.T) {
+	Convey("Testing export() and importBundle()", t, func() {
+		var act int
+		exitCmd = func(i int) { act = i }
+
+		dir, err := ioutil.TempDir("/tmp", "testBlacklist")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		o := getOpts()
+		*o.DNSdir, *o.DNStmp, *o.BdlKey = dir, dir, dir+"/blacklist.bundle.key"
+		*o.Export, *o.Import = dir+"/blacklist.bundle.tgz", dir+"/blacklist.bundle.tgz"
+
+		act = -1
+		export(o.initEdgeOS(), o)
+		So(act, ShouldEqual, 0)
+		_, err = os.Stat(*o.BdlKey + ".pub")
+		So(err, ShouldBeNil)
+
+		c := o.initEdgeOS()
+		act = -1
+		importBundle(c, o)
+		So(act, ShouldEqual, -1)
+		So(c.Bundled(), ShouldBeTrue)
+
+		*o.BdlAge = -time.Second
+		importBundle(o.initEdgeOS(), o)
+		So(act, ShouldEqual, 1)
+
+		*o.Export = dir + "/missing/blacklist.bundle.tgz"
+		act = -1
+		export(o.initEdgeOS(), o)
+		So(act, ShouldEqual, 1)
+	})
+}
+
+func TestServe(t *testing.T) {
+	Convey("Testing serve()", t, func() {
+		var act int
+		exitCmd = func(i int) { act = i }
+
+		dir, err := ioutil.TempDir("/tmp", "testBlacklist")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		o := getOpts()
+		*o.DNSdir, *o.DNStmp = dir, dir
+		c := o.initEdgeOS()
+
+		So(ioutil.WriteFile(dir+"/domains.malc0de.blacklist.conf", []byte("address=/bad.com/0.0.0.0\n"), 0644), ShouldBeNil)
+		So(ioutil.WriteFile(dir+"/other.conf", []byte("address=/good.com/0.0.0.0\n"), 0644), ShouldBeNil)
+		So(os.Mkdir(c.HostsDir, 0755), ShouldBeNil)
+		So(ioutil.WriteFile(c.HostsDir+"/hosts.yoyo.hosts", []byte("0.0.0.0 ads.com\n"), 0644), ShouldBeNil)
+		b, err := blockSet(c)
+		So(err, ShouldBeNil)
+		So(b.Keys(), ShouldResemble, []string{"ads.com", "bad.com"})
+
+		Convey("safe search's cname= and host-record= lines aren't served", func() {
+			var warn string
+			origWarnf := logWarnf
+			defer func() { logWarnf = origWarnf }()
+			logWarnf = func(f string, v ...interface{}) { warn = fmt.Sprintf(f, v...) }
+
+			f := c.SafeSearchFile()
+			So(ioutil.WriteFile(f, []byte("address=/school.org/10.0.0.53\ncname=www.google.com,forcesafesearch.google.com\nhost-record=forcesafesearch.google.com,216.239.38.120\n"), 0644), ShouldBeNil)
+			b, err := blockSet(c)
+			So(err, ShouldBeNil)
+			So(b.Keys(), ShouldResemble, []string{"ads.com", "bad.com", "school.org"})
+			So(warn, ShouldEqual, "-serve doesn't answer the cname= and host-record= lines in "+f+", so safe search is only enforced for redirects to an IP address")
+		})
+
+		Convey("without upstream resolvers", func() {
+			*o.Upstream = " , "
+			act = -1
+			serve(c, o)
+			So(act, ShouldEqual, 1)
+		})
+
+		Convey("a refresh without a blacklist configuration keeps the blacklist files", func() {
+			*o.File = dir + "/bad.cfg"
+			So(ioutil.WriteFile(*o.File, []byte("service {\n}\n"), 0644), ShouldBeNil)
+			act = -1
+			_, err := reconfigure(o)
+			So(err, ShouldNotBeNil)
+			So(act, ShouldEqual, -1)
+			_, err = os.Stat(dir + "/domains.malc0de.blacklist.conf")
+			So(err, ShouldBeNil)
+
+			*o.File = "internal/testdata/config.erx.boot"
+			c, err := reconfigure(o)
+			So(err, ShouldBeNil)
+			So(c, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestValidReload(t *testing.T) {
+	Convey("Testing validReload()", t, func() {
+		for _, r := range e.Reloads {
+			So(validReload(r), ShouldBeTrue)
+		}
+		So(validReload("HUP"), ShouldBeFalse)
+	})
+}
+
+func TestConfigure(t *testing.T) {
+	Convey("Testing configure()", t, func() {
+		var act int
+		exitCmd = func(i int) { act = i }
+
+		tests := []struct {
+			exp  int
+			name string
+			set  func(o *opts)
+		}{
+			{name: "no changes", exp: -1, set: func(o *opts) {}},
+			{name: "an include", exp: 0, set: func(o *opts) { *o.Node, *o.AddInc = "domains", "bad.com" }},
+			{name: "a source", exp: 0, set: func(o *opts) { *o.Node, *o.AddSrc, *o.SrcURL = "hosts", "ads", "http://x.com/hosts" }},
+			{name: "a source without a url or file", exp: 1, set: func(o *opts) { *o.Node, *o.AddSrc = "hosts", "ads" }},
+			{name: "an invalid node", exp: 1, set: func(o *opts) { *o.Node, *o.DisSrc = "zones", "yoyo" }},
+			{name: "a failed commit", exp: 1, set: func(o *opts) { *o.AddExc = "fail" }},
+		}
+
+		for _, tt := range tests {
+			Convey("with "+tt.name, func() {
+				o := getOpts()
+				tt.set(o)
+				c := o.initEdgeOS()
+				_ = c.SetOpt(e.Shell("internal/testdata/fake_cli_shell.sh"))
+				act = -1
+				configure(c, o)
+				So(act, ShouldEqual, tt.exp)
+			})
+		}
+	})
+}
+
 func TestNewScreenLogBackend(t *testing.T) {
 	tests := []struct {
 		exp    bool
@@ -506,6 +774,7 @@ func TestInitEdgeOS(t *testing.T) {
 	"API": "/bin/cli-shell-api",
 	"Arch": "amd64",
 	"Bash": "/bin/bash",
+	"Catalog file": "/tmp/blacklist.catalog.json",
 	"Cores": 2,
 	"Disabled": false,
 	"Dex": {},
@@ -514,8 +783,14 @@ func TestInitEdgeOS(t *testing.T) {
 	"Exc": {},
 	"dnsmasq fileExt.": "blacklist.conf",
 	"File name fmt": "%v/%v.%v.%v",
+	"Hits file": "/tmp/blacklist.hits.json",
+	"Hosts dir": "/tmp/blacklist.hosts",
 	"HTTP method": "GET",
 	"Prefix": {},
+	"PID file": "/var/run/dnsmasq/dnsmasq.pid",
+	"Reload": "restart",
+	"CLI shell": "/opt/vyatta/sbin/my_cli_shell",
+	"State file": "/tmp/blacklist.state.json",
 	"Timeout": 30000000000,
 	"Wildcard": {
 		"Node": "*s",
@@ -773,7 +1048,6 @@ var (
 "ssl-on9.net":{},
 "sstatic.net":{},
 "static.chartbeat.com":{},
-"storage.googleapis.com":{},
 "twimg.com":{},
 "viewpoint.com":{},
 "windows.net":{},
@@ -782,3 +1056,33 @@ var (
 "ytimg.com":{},
 `
 )
+
+func TestRefreshUnchanged(t *testing.T) {
+	Convey("Testing an unchanged refresh with the allowlist and safe search doesn't reload dnsmasq", t, func() {
+		exitCmd = func(int) {}
+		dir, err := ioutil.TempDir("/tmp", "testBlacklist")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		o := getOpts()
+		*o.DNSdir, *o.DNStmp = dir, dir
+		origFile := *o.File
+		*o.File = "internal/testdata/config.unchanged.boot"
+		defer func() { *o.File = origFile }()
+
+		// run refreshes the blacklist as main does and returns whether dnsmasq would be reloaded
+		run := func() bool {
+			c := o.initEdgeOS()
+			So(c.Blacklist(o.getCFG(c)), ShouldBeNil)
+			refresh(c)
+			return c.Changed()
+		}
+
+		So(run(), ShouldBeTrue)
+		So(run(), ShouldBeFalse)
+		for _, f := range []string{"allowlists.allowlist.blacklist.conf", "restrictions.safe-search.blacklist.conf"} {
+			_, err = os.Stat(dir + "/" + f)
+			So(err, ShouldBeNil)
+		}
+	})
+}
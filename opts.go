@@ -17,19 +17,55 @@ import (
 // opts struct for command line options and setting initial variables
 type opts struct {
 	*mflag.FlagSet
-	ARCH    *string
-	Dbug    *bool
-	DNSdir  *string
-	DNStmp  *string
-	File    *string
-	Help    *bool
-	MIPSLE  *string
-	MIPS64  *string
-	OS      *string
-	Safe    *bool
-	Test    *bool
-	Verb    *bool
-	Version *bool
+	AddExc   *string
+	AddInc   *string
+	AddSrc   *string
+	Allow    *string
+	ARCH     *string
+	BdlAge   *time.Duration
+	BdlKey   *string
+	Dbug     *bool
+	DelExc   *string
+	DelInc   *string
+	DelSrc   *string
+	DisSrc   *string
+	DNSconf  *string
+	DNSdir   *string
+	DNStmp   *string
+	Effectv  *bool
+	EnaSrc   *string
+	Export   *string
+	File     *string
+	For      *time.Duration
+	Help     *bool
+	Import   *string
+	Listen   *string
+	MIPSLE   *string
+	MIPS64   *string
+	Node     *string
+	OS       *string
+	Overlap  *bool
+	QueryLog *string
+	Refresh  *time.Duration
+	Reload   *string
+	Resolver *string
+	Safe     *bool
+	Samples  *int
+	Serve    *bool
+	SrcDesc  *string
+	SrcFile  *string
+	SrcIP    *string
+	SrcPfx   *string
+	SrcURL   *string
+	Status   *bool
+	TCP      *bool
+	Test     *bool
+	Top      *int
+	Upstream *string
+	Validate *bool
+	Verb     *bool
+	Verify   *bool
+	Version  *bool
 }
 
 // cleanArgs removes flags when code is being tested
@@ -45,6 +81,48 @@ func cleanArgs(args []string) (r []string) {
 	return r
 }
 
+// changes returns the EdgeOS CLI commands for the configuration changes set on the command line
+func (o *opts) changes() (cmds []string, err error) {
+	for _, f := range []struct {
+		cmd  func(node, name string) ([]string, error)
+		name string
+	}{
+		{cmd: e.AddExclude, name: *o.AddExc},
+		{cmd: e.AddInclude, name: *o.AddInc},
+		{cmd: e.DeleteExclude, name: *o.DelExc},
+		{cmd: e.DeleteInclude, name: *o.DelInc},
+		{cmd: e.DeleteSource, name: *o.DelSrc},
+		{cmd: e.DisableSource, name: *o.DisSrc},
+		{cmd: e.EnableSource, name: *o.EnaSrc},
+	} {
+		if f.name == "" {
+			continue
+		}
+		c, err := f.cmd(*o.Node, f.name)
+		if err != nil {
+			return nil, err
+		}
+		cmds = append(cmds, c...)
+	}
+
+	if *o.AddSrc != "" {
+		c, err := e.AddSource(e.SourceArgs{
+			Desc:   *o.SrcDesc,
+			File:   *o.SrcFile,
+			IP:     *o.SrcIP,
+			Name:   *o.AddSrc,
+			Node:   *o.Node,
+			Prefix: *o.SrcPfx,
+			URL:    *o.SrcURL,
+		})
+		if err != nil {
+			return nil, err
+		}
+		cmds = append(cmds, c...)
+	}
+	return cmds, nil
+}
+
 // getCFG returns a e.ConfLoader
 func (o *opts) getCFG(c *e.Config) e.ConfLoader {
 	if _, err := os.Stat(*o.File); !os.IsNotExist(err) {
@@ -75,20 +153,56 @@ func getOpts() *opts {
 	var (
 		flags mflag.FlagSet
 		o     = &opts{
-			FlagSet: &flags,
-			ARCH:    flags.String("arch", runtime.GOARCH, "Set EdgeOS CPU architecture", false),
-			DNSdir:  flags.String("dir", "/etc/dnsmasq.d", "Override dnsmasq directory", true),
-			DNStmp:  flags.String("tmp", "/tmp", "Override dnsmasq temporary directory", false),
-			Dbug:    flags.Bool("debug", false, "Enable Debug mode", false),
-			File:    flags.String("f", "", "`<file>` # Load a config.boot file", true),
-			Help:    flags.Bool("h", false, "Display help", true),
-			MIPS64:  flags.String("mips64", "mips64", "Override target EdgeOS CPU architecture", false),
-			MIPSLE:  flags.String("mipsle", "mipsle", "Override target EdgeOS CPU architecture", false),
-			OS:      flags.String("os", runtime.GOOS, "Override native EdgeOS OS", false),
-			Safe:    flags.Bool("safe", false, fmt.Sprintf("Fail over to %s", defCfgFile), true),
-			Test:    flags.Bool("dryrun", false, "Run config and data validation tests", false),
-			Verb:    flags.Bool("v", false, "Verbose display", true),
-			Version: flags.Bool("version", false, "Show version", true),
+			FlagSet:  &flags,
+			AddExc:   flags.String("add-exclude", "", "`<domain>` # Whitelist a domain on the -node", true),
+			AddInc:   flags.String("add-include", "", "`<domain>` # Blacklist a domain on the -node", true),
+			AddSrc:   flags.String("add-source", "", "`<name>` # Add a -node source using -url or -src-file, -description, -ip and -prefix", true),
+			Allow:    flags.String("allow", "", "`<domain>` # Stop blocking a domain for the -for duration, reloading only the blacklist files that block it", true),
+			ARCH:     flags.String("arch", runtime.GOARCH, "Set EdgeOS CPU architecture", false),
+			BdlAge:   flags.Duration("bundle-age", 7*24*time.Hour, "`<duration>` # Reject bundles older than this as stale, e.g. 72h", true),
+			BdlKey:   flags.String("bundle-key", defBundleKey, "`<file>` # Key -export-bundle signs with, generated if it doesn't exist; -import-bundle checks signatures with its public key, file.pub", true),
+			DelExc:   flags.String("delete-exclude", "", "`<domain>` # Remove a whitelisted domain from the -node", true),
+			DelInc:   flags.String("delete-include", "", "`<domain>` # Remove a blacklisted domain from the -node", true),
+			DelSrc:   flags.String("delete-source", "", "`<name>` # Delete a -node source", true),
+			DisSrc:   flags.String("disable-source", "", "`<name>` # Disable a -node source", true),
+			DNSconf:  flags.String("dnsmasq-conf", "/etc/dnsmasq.conf", "`<file>` # dnsmasq configuration read by -effective", true),
+			DNSdir:   flags.String("dir", "/etc/dnsmasq.d", "Override dnsmasq directory", true),
+			DNStmp:   flags.String("tmp", "/tmp", "Override dnsmasq temporary directory", false),
+			Dbug:     flags.Bool("debug", false, "Enable Debug mode", false),
+			Effectv:  flags.Bool("effective", false, "Display every domain dnsmasq blocks, including those configured by other tools", true),
+			EnaSrc:   flags.String("enable-source", "", "`<name>` # Enable a disabled -node source", true),
+			Export:   flags.String("export-bundle", "", "`<file>` # Download every url source into a signed bundle, for routers without internet access", true),
+			File:     flags.String("f", "", "`<file>` # Load a config.boot file", true),
+			For:      flags.Duration("for", 30*time.Minute, "`<duration>` # How long -allow stops blocking the domain, e.g. 30m", true),
+			Help:     flags.Bool("h", false, "Display help", true),
+			Import:   flags.String("import-bundle", "", "`<file>` # Update the blacklist from a bundle made with -export-bundle, instead of downloading the url sources", true),
+			Listen:   flags.String("listen", "127.0.0.1:53", "`<[ip]:port>` # Address -serve answers queries on; use a LAN address to serve other hosts, never a WAN one", true),
+			MIPS64:   flags.String("mips64", "mips64", "Override target EdgeOS CPU architecture", false),
+			MIPSLE:   flags.String("mipsle", "mipsle", "Override target EdgeOS CPU architecture", false),
+			Node:     flags.String("node", "blacklist", "`<node>` # Blacklist node to change: blacklist, domains or hosts", true),
+			OS:       flags.String("os", runtime.GOOS, "Override native EdgeOS OS", false),
+			Overlap:  flags.Bool("overlap", false, "Report how many entries each source uniquely contributes and shares with other sources", true),
+			QueryLog: flags.String("query-log", "/var/log/messages", "`<file>` # dnsmasq log-queries log or syslog read by -top", true),
+			Refresh:  flags.Duration("refresh", 24*time.Hour, "`<duration>` # How often -serve updates the blacklist, e.g. 12h", true),
+			Reload:   flags.String("reload", "restart", "`<restart|sighup|reload>` # How dnsmasq picks up blacklist changes: sighup and reload write hosts sources as hosts files, which it re-reads without restarting; any other change still restarts it", true),
+			Resolver: flags.String("resolver", "127.0.0.1", "`<ip[:port]>` # DNS server queried by -verify", true),
+			Safe:     flags.Bool("safe", false, fmt.Sprintf("Fail over to %s", defCfgFile), true),
+			Samples:  flags.Int("samples", 10, "`<n>` # Entries sampled from each blacklist file by -verify", true),
+			Serve:    flags.Bool("serve", false, "Update the blacklist and answer DNS queries from it, forwarding the rest to -upstream, without dnsmasq", true),
+			SrcDesc:  flags.String("description", "", "`<text>` # Description for -add-source", true),
+			SrcFile:  flags.String("src-file", "", "`<file>` # Local file for -add-source", true),
+			SrcIP:    flags.String("ip", "", "`<ip>` # dns-redirect-ip for -add-source", true),
+			SrcPfx:   flags.String("prefix", "", "`<prefix>` # Line prefix for -add-source", true),
+			SrcURL:   flags.String("url", "", "`<url>` # URL for -add-source", true),
+			Status:   flags.Bool("status", false, "Display each source's entries from the last run and the temporary exceptions made with -allow, with when they expire", true),
+			TCP:      flags.Bool("tcp", false, "Query the -resolver over TCP instead of UDP", true),
+			Test:     flags.Bool("dryrun", false, "Run config and data validation tests", false),
+			Top:      flags.Int("top", 0, "`<n>` # Count the blocked queries in the -query-log, then display each source's hits and the n most blocked domains and clients", true),
+			Upstream: flags.String("upstream", "", "`<ip[:port],...>` # Resolvers -serve forwards queries that aren't blacklisted to", true),
+			Validate: flags.Bool("validate", false, "Validate the blacklist configuration and report any problems", true),
+			Verb:     flags.Bool("v", false, "Verbose display", true),
+			Verify:   flags.Bool("verify", false, "Query the -resolver for a sample of each blacklist file's entries and report any that aren't blocked", true),
+			Version:  flags.Bool("version", false, "Show version", true),
 		}
 	)
 	flags.Init(prog, mflag.ExitOnError)
@@ -106,6 +220,7 @@ func (o *opts) initEdgeOS() *e.Config {
 		e.API("/bin/cli-shell-api"),
 		e.Arch(runtime.GOARCH),
 		e.Bash("/bin/bash"),
+		e.Catalog(o.setCatalog(*o.ARCH)),
 		e.Cores(2),
 		e.Disabled(false),
 		e.Dbug(*o.Dbug),
@@ -114,10 +229,17 @@ func (o *opts) initEdgeOS() *e.Config {
 		e.Ext("blacklist.conf"),
 		e.File(*o.File),
 		e.FileNameFmt("%v/%v.%v.%v"),
+		e.Hits(o.setHits(*o.ARCH)),
+		e.HostsDir(o.setHosts(*o.ARCH)),
 		e.InCLI("inSession"),
 		e.Method("GET"),
+		e.Overlap(*o.Overlap),
 		e.Prefix("address=", "server="),
 		e.Logger(log),
+		e.PIDfile("/var/run/dnsmasq/dnsmasq.pid"),
+		e.Reload(*o.Reload),
+		e.Shell("/opt/vyatta/sbin/my_cli_shell"),
+		e.State(o.setState(*o.ARCH)),
 		e.Timeout(30*time.Second),
 		e.Verb(*o.Verb),
 		e.WCard(e.Wildcard{Node: "*s", Name: "*"}),
@@ -149,6 +271,11 @@ func (o *opts) setArgs() {
 		screenLog("")
 	}
 
+	if !validReload(*o.Reload) {
+		fmt.Fprintf(os.Stderr, "%s-reload must be one of %s\n", prefix, strings.Join(e.Reloads, ", "))
+		exitCmd(1)
+	}
+
 	if *o.Version {
 		fmt.Printf(
 			" Build Information:\n"+
@@ -180,3 +307,49 @@ func (o *opts) setDir(arch string) string {
 	}
 	return *o.DNStmp
 }
+
+// setCatalog returns the location of the local file that updates the built in catalog
+func (o *opts) setCatalog(arch string) string {
+	switch arch {
+	case *o.MIPSLE, *o.MIPS64:
+		return defCatalogFile
+	}
+	return *o.DNStmp + "/blacklist.catalog.json"
+}
+
+// setHits returns the hits file location, which must persist across reboots on a router
+func (o *opts) setHits(arch string) string {
+	switch arch {
+	case *o.MIPSLE, *o.MIPS64:
+		return defHitsFile
+	}
+	return *o.DNStmp + "/blacklist.hits.json"
+}
+
+// setHosts returns the directory hosts format blacklist files are written to
+func (o *opts) setHosts(arch string) string {
+	switch arch {
+	case *o.MIPSLE, *o.MIPS64:
+		return defHostsDir
+	}
+	return *o.DNStmp + "/blacklist.hosts"
+}
+
+// setState returns the state file location, which must persist across reboots on a router
+func (o *opts) setState(arch string) string {
+	switch arch {
+	case *o.MIPSLE, *o.MIPS64:
+		return defStateFile
+	}
+	return *o.DNStmp + "/blacklist.state.json"
+}
+
+// validReload returns true if r is one of the reload strategies
+func validReload(r string) bool {
+	for _, v := range e.Reloads {
+		if r == v {
+			return true
+		}
+	}
+	return false
+}